@@ -15,8 +15,10 @@ type Debuggable interface {
 }
 
 type entityWithName struct {
-	Id   ecs.EntityId
-	Name *ecs.NameComponent `ecs:"optional"`
+	Id       ecs.EntityId
+	Name     *ecs.NameComponent     `ecs:"optional"`
+	Parent   *ecs.ParentComponent   `ecs:"optional"`
+	Children *ecs.ChildrenComponent `ecs:"optional"`
 }
 
 var entityWithNameQuery = ecs.NewQuery[entityWithName]()
@@ -54,6 +56,11 @@ func (d *ECSDebugSystem) renderDebugWindow(sim *ecs.Simulation) {
 		imgui.EndTabItem()
 	}
 
+	if imgui.BeginTabItem("Resources") {
+		d.renderResources(sim)
+		imgui.EndTabItem()
+	}
+
 	imgui.EndTabBar()
 	imgui.End()
 
@@ -89,6 +96,22 @@ func (d *ECSDebugSystem) renderSystems(sim *ecs.Simulation) {
 	}
 }
 
+func (d *ECSDebugSystem) renderResources(sim *ecs.Simulation) {
+	for _, resource := range sim.Resources() {
+		resourceType := reflect.TypeOf(resource).Elem()
+		if imgui.CollapsingHeader(resourceType.String()) {
+			if resourceType.Kind() == reflect.Struct {
+				RenderStruct(resource)
+			} else {
+				imgui.Text(fmt.Sprintf("%v", reflect.ValueOf(resource).Elem().Interface()))
+			}
+			if dbg, ok := resource.(Debuggable); ok {
+				dbg.Debug()
+			}
+		}
+	}
+}
+
 func (d *ECSDebugSystem) renderOpenEntities(sim *ecs.Simulation) {
 	for entityId := range d.openEntityWindows {
 		open := true
@@ -128,23 +151,53 @@ func (d *ECSDebugSystem) renderEntities(sim *ecs.Simulation) {
 		iter := entityWithNameQuery.Execute(sim)
 		iter.Sort()
 
+		entities := map[ecs.EntityId]entityWithName{}
+		roots := []ecs.EntityId{}
 		for iter.Next() {
-			imgui.TableNextRow()
-			imgui.TableNextColumn()
-			imgui.Text(fmt.Sprintf("%v", iter.Item.Id))
-
-			imgui.TableNextColumn()
-			if iter.Item.Name != nil {
-				imgui.Text(iter.Item.Name.Name)
-			} else {
-				imgui.Text("")
+			entities[iter.Item.Id] = iter.Item
+			if iter.Item.Parent == nil {
+				roots = append(roots, iter.Item.Id)
 			}
+		}
 
-			imgui.TableNextColumn()
-			if imgui.Button(fmt.Sprintf("View###%v", iter.Item.Id)) {
-				d.openEntityWindows[iter.Item.Id] = struct{}{}
-			}
+		for _, id := range roots {
+			d.renderEntityRow(entities, id)
 		}
 		imgui.EndTable()
 	}
 }
+
+// renderEntityRow renders an entity as a node within the hierarchy, followed by its children
+// when expanded.
+func (d *ECSDebugSystem) renderEntityRow(entities map[ecs.EntityId]entityWithName, id ecs.EntityId) {
+	entity := entities[id]
+
+	imgui.TableNextRow()
+	imgui.TableNextColumn()
+	flags := imgui.TreeNodeFlagsSpanFullWidth
+	if entity.Children == nil || len(entity.Children.Children) == 0 {
+		flags |= imgui.TreeNodeFlagsLeaf
+	}
+	open := imgui.TreeNodeV(fmt.Sprintf("%v", id), flags)
+
+	imgui.TableNextColumn()
+	if entity.Name != nil {
+		imgui.Text(entity.Name.Name)
+	} else {
+		imgui.Text("")
+	}
+
+	imgui.TableNextColumn()
+	if imgui.Button(fmt.Sprintf("View###%v", id)) {
+		d.openEntityWindows[id] = struct{}{}
+	}
+
+	if open {
+		if entity.Children != nil {
+			for _, child := range entity.Children.Children {
+				d.renderEntityRow(entities, child)
+			}
+		}
+		imgui.TreePop()
+	}
+}
@@ -0,0 +1,86 @@
+package ecs
+
+import "fmt"
+
+// componentInfoOrError returns the registration of the component type T, or an error
+// wrapping ErrInvalidComponentType if it is not registered.
+func componentInfoOrError[T any]() (*ComponentInfo, error) {
+	info, exists := componentInfoOf[T]()
+	if !exists {
+		var zero T
+		return nil, fmt.Errorf("%w: component type %T is not registered, see RegisterComponent", ErrInvalidComponentType, zero)
+	}
+	return info, nil
+}
+
+// Get returns the entity's component of type T. The returned pointer is the stored component,
+// so changes to it are visible to queries (use MarkChanged to report them to `ecs:"changed"`
+// query fields). Storages may move components as entities change, so the pointer should not
+// be kept once entities are deleted or have components added or removed, see EntityStorage.
+func Get[T any](sim *Simulation, id EntityId) (*T, bool) {
+	info, exists := componentInfoOf[T]()
+	if !exists || !sim.IsAlive(id) {
+		return nil, false
+	}
+
+	component, ok := sim.Storage.GetComponent(id, info.Id).(*T)
+	return component, ok
+}
+
+// GetMut returns the entity's component of type T like Get, marking it as changed so that
+// `ecs:"changed"` query fields see any modifications made through the returned pointer.
+func GetMut[T any](sim *Simulation, id EntityId) (*T, bool) {
+	info, exists := componentInfoOf[T]()
+	if !exists || !sim.IsAlive(id) {
+		return nil, false
+	}
+
+	component, ok := sim.Storage.GetComponent(id, info.Id).(*T)
+	if ok {
+		sim.Storage.MarkChanged(id, info.Id)
+	}
+	return component, ok
+}
+
+// Has returns whether the entity has a component of type T.
+func Has[T any](sim *Simulation, id EntityId) bool {
+	_, ok := Get[T](sim, id)
+	return ok
+}
+
+// Insert adds the component to the entity, replacing any existing component of type T, and
+// returns the stored component. An error is returned if the entity is not alive or T is not
+// a registered component type.
+func Insert[T any](sim *Simulation, id EntityId, component T) (*T, error) {
+	info, err := componentInfoOrError[T]()
+	if err != nil {
+		return nil, err
+	}
+	if err := sim.checkEntity(id); err != nil {
+		return nil, err
+	}
+
+	if err := sim.insertComponent(id, info, &component); err != nil {
+		return nil, err
+	}
+	// storages may copy the component, so the stored pointer is read back
+	return sim.Storage.GetComponent(id, info.Id).(*T), nil
+}
+
+// Remove removes the entity's component of type T, returning whether it had one.
+func Remove[T any](sim *Simulation, id EntityId) bool {
+	info, exists := componentInfoOf[T]()
+	if !exists {
+		return false
+	}
+	return sim.removeComponent(id, info) == nil
+}
+
+// GetOrInsert returns the entity's component of type T, inserting the given component if the
+// entity does not have one yet.
+func GetOrInsert[T any](sim *Simulation, id EntityId, component T) (*T, error) {
+	if existing, ok := Get[T](sim, id); ok {
+		return existing, nil
+	}
+	return Insert(sim, id, component)
+}
@@ -0,0 +1,119 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericAccessors(t *testing.T) {
+	testGenericAccessors(t, NewSimpleSimulation())
+}
+
+func TestGenericAccessorsArchetype(t *testing.T) {
+	// archetype storage copies components, so accessors must return the stored copy
+	testGenericAccessors(t, NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor()))
+}
+
+func testGenericAccessors(t *testing.T, sim *Simulation) {
+	id := sim.AddEntity(&testComponent{a: 1})
+
+	test, ok := Get[testComponent](sim, id)
+	assert.True(t, ok)
+	test.a = 2
+	again, _ := Get[testComponent](sim, id)
+	assert.Equal(t, int32(2), again.a, "changes through the returned pointer should be stored")
+	assert.True(t, Has[testComponent](sim, id))
+	assert.False(t, Has[otherComponent](sim, id))
+	assert.False(t, Has[unregisteredComponent](sim, id))
+
+	other, err := Insert(sim, id, otherComponent{x: 5})
+	assert.NoError(t, err)
+	stored, ok := Get[otherComponent](sim, id)
+	assert.True(t, ok)
+	assert.Same(t, other, stored, "insert should return the stored component")
+
+	existing, err := GetOrInsert(sim, id, otherComponent{x: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, existing.x, "existing components should not be replaced")
+
+	assert.True(t, Remove[otherComponent](sim, id))
+	assert.False(t, Remove[otherComponent](sim, id))
+	assert.False(t, Remove[unregisteredComponent](sim, id))
+
+	inserted, err := GetOrInsert(sim, id, otherComponent{x: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, inserted.x)
+
+	_, err = Insert(sim, id, unregisteredComponent{})
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+
+	sim.DeleteEntity(id)
+	_, ok = Get[testComponent](sim, id)
+	assert.False(t, ok)
+	_, err = Insert(sim, id, testComponent{})
+	assert.ErrorIs(t, err, ErrStaleEntity)
+	_, err = GetOrInsert(sim, id, testComponent{})
+	assert.ErrorIs(t, err, ErrStaleEntity)
+}
+
+func TestGenericAccessorsReportRemovals(t *testing.T) {
+	sim := NewSimpleSimulation()
+	id := sim.AddEntity(&testComponent{a: 1})
+
+	reader := &RemovedComponents[testComponent]{}
+	assert.True(t, Remove[testComponent](sim, id))
+	removed := reader.Read(sim)
+	assert.Len(t, removed, 1)
+	assert.Equal(t, int32(1), removed[0].Component.a)
+}
+
+func benchmarkAccessorSimulation(count int) (*Simulation, []EntityId) {
+	sim := NewSimpleSimulation()
+	ids := make([]EntityId, count)
+	for n := range ids {
+		ids[n] = sim.AddEntity(&testComponent{a: int32(n)})
+	}
+	return sim, ids
+}
+
+func BenchmarkGenericGet(b *testing.B) {
+	sim, ids := benchmarkAccessorSimulation(1000)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Get[testComponent](sim, ids[n%len(ids)])
+	}
+}
+
+func BenchmarkSimulationGetComponent(b *testing.B) {
+	sim, ids := benchmarkAccessorSimulation(1000)
+	var component testComponent
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		sim.GetComponent(ids[n%len(ids)], &component)
+	}
+}
+
+func BenchmarkGenericInsertRemove(b *testing.B) {
+	sim, ids := benchmarkAccessorSimulation(1000)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		id := ids[n%len(ids)]
+		Insert(sim, id, otherComponent{x: n})
+		Remove[otherComponent](sim, id)
+	}
+}
+
+func BenchmarkSimulationAddRemoveComponent(b *testing.B) {
+	sim, ids := benchmarkAccessorSimulation(1000)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		id := ids[n%len(ids)]
+		sim.AddComponent(id, &otherComponent{x: n})
+		sim.RemoveComponent(id, otherComponent{})
+	}
+}
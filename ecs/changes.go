@@ -0,0 +1,63 @@
+package ecs
+
+import (
+	"sync/atomic"
+)
+
+// ComponentTicks records the change ticks at which a component was added to an entity and
+// when it was last changed. Adding a component also counts as changing it.
+type ComponentTicks struct {
+	Added   uint64
+	Changed uint64
+}
+
+func newComponentTicks(tick uint64) ComponentTicks {
+	return ComponentTicks{Added: tick, Changed: tick}
+}
+
+// changeTicker tracks the current change tick of a storage. Ticks start at one so that
+// components added before any system has run are seen as added by every system.
+type changeTicker struct {
+	// advanced is the number of times the tick has been advanced
+	advanced atomic.Uint64
+}
+
+// ChangeTick returns the current change tick, which newly added or changed components are
+// stamped with.
+func (c *changeTicker) ChangeTick() uint64 {
+	return c.advanced.Load() + 1
+}
+
+// AdvanceChangeTick increments and returns the current change tick.
+func (c *changeTicker) AdvanceChangeTick() uint64 {
+	return c.advanced.Add(1) + 1
+}
+
+// MatchesTicks returns whether an entity matches the added and changed components of the
+// filter, given a function which returns the ticks of the entity's component of a type.
+func (f QueryFilter) MatchesTicks(ticks func(ComponentId) (ComponentTicks, bool)) bool {
+	for _, component := range f.Added {
+		componentTicks, exists := ticks(component)
+		if !exists || componentTicks.Added <= f.Since {
+			return false
+		}
+	}
+
+	for _, component := range f.Changed {
+		componentTicks, exists := ticks(component)
+		if !exists || componentTicks.Changed <= f.Since {
+			return false
+		}
+	}
+	return true
+}
+
+// tracksChanges returns whether the filter includes any added or changed components.
+func (f QueryFilter) tracksChanges() bool {
+	return len(f.Added) > 0 || len(f.Changed) > 0
+}
+
+// tracksRelations returns whether the filter includes any relations.
+func (f QueryFilter) tracksRelations() bool {
+	return len(f.Relations) > 0 || len(f.WithoutRelations) > 0
+}
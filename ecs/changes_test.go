@@ -0,0 +1,140 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mutatorSystem mutates componentA of its targets through a mutable query field.
+type mutatorSystem struct {
+	query *Query[struct {
+		A *componentA `ecs:"mut"`
+	}]
+	targets []EntityId
+}
+
+func (m *mutatorSystem) Update(frame *SimulationFrame) {
+	for _, id := range m.targets {
+		m.query.Get(frame.Sim, id).A.A += 1
+		m.query.MarkChanged(frame.Sim, id)
+	}
+	m.targets = nil
+}
+
+func (m *mutatorSystem) Render(frame *SimulationFrame) {}
+
+// watcherSystem records the entities it observed with changed or added components.
+type watcherSystem struct {
+	changed *Query[struct {
+		Id EntityId
+		A  *componentA `ecs:"changed,read"`
+	}]
+	added *Query[struct {
+		Id EntityId
+		B  *componentB `ecs:"added,read"`
+	}]
+	seenChanged []EntityId
+	seenAdded   []EntityId
+}
+
+func (w *watcherSystem) Update(frame *SimulationFrame) {
+	w.seenChanged = []EntityId{}
+	for _, item := range w.changed.ExecuteFrame(frame).ToList() {
+		w.seenChanged = append(w.seenChanged, item.Id)
+	}
+
+	w.seenAdded = []EntityId{}
+	for _, item := range w.added.ExecuteFrame(frame).ToList() {
+		w.seenAdded = append(w.seenAdded, item.Id)
+	}
+}
+
+func (w *watcherSystem) Render(frame *SimulationFrame) {}
+
+func testChangeDetection(t *testing.T, executor interface {
+	SystemExecutor
+	Add(...System)
+}) {
+	mutator := &mutatorSystem{query: NewQuery[struct {
+		A *componentA `ecs:"mut"`
+	}]()}
+	watcher := &watcherSystem{
+		changed: NewQuery[struct {
+			Id EntityId
+			A  *componentA `ecs:"changed,read"`
+		}](),
+		added: NewQuery[struct {
+			Id EntityId
+			B  *componentB `ecs:"added,read"`
+		}](),
+	}
+	executor.Add(mutator, watcher)
+
+	sim := NewSimulation(NewEntityArchetypeStorage(), executor)
+	assert.NoError(t, sim.Setup())
+
+	ids := []EntityId{}
+	for n := 0; n < 10; n++ {
+		ids = append(ids, sim.AddEntity(&componentA{A: float64(n)}))
+	}
+
+	// everything is new the first time a system runs
+	sim.Update()
+	assert.Len(t, watcher.seenChanged, 10)
+	assert.Len(t, watcher.seenAdded, 0)
+
+	sim.Update()
+	assert.Len(t, watcher.seenChanged, 0, "unchanged components should not match")
+
+	// reading mutable fields does not mark them as changed
+	mutator.query.Execute(sim).ToList()
+	sim.Update()
+	assert.Len(t, watcher.seenChanged, 0, "reading components should not mark them as changed")
+
+	mutator.targets = []EntityId{ids[3]}
+	sim.AddComponent(ids[5], &componentB{})
+	sim.Update()
+	assert.Equal(t, []EntityId{ids[3]}, watcher.seenChanged)
+	assert.Equal(t, []EntityId{ids[5]}, watcher.seenAdded)
+
+	sim.MarkChanged(ids[7], componentA{})
+	if a, ok := GetMut[componentA](sim, ids[9]); ok {
+		a.A = 0
+	}
+	result := mutator.query.Execute(sim)
+	for result.Next() {
+		if result.Item.A.A == 6 {
+			result.MarkChanged()
+		}
+	}
+	sim.Frame.Commands.AddComponent(ids[8], &componentB{})
+	sim.Update()
+	assert.ElementsMatch(t, []EntityId{ids[6], ids[7], ids[9]}, watcher.seenChanged)
+	assert.Len(t, watcher.seenAdded, 0, "commands flushed at the end of the tick should not be seen yet")
+
+	sim.Update()
+	assert.Len(t, watcher.seenChanged, 0)
+	assert.Equal(t, []EntityId{ids[8]}, watcher.seenAdded)
+}
+
+func TestChangeDetectionSequential(t *testing.T) {
+	testChangeDetection(t, NewSequentialSystemExecutor())
+}
+
+func TestChangeDetectionParallel(t *testing.T) {
+	testChangeDetection(t, NewParallelSystemExecutor())
+}
+
+func TestQueryChangedWithoutFrame(t *testing.T) {
+	sim := NewSimpleSimulation()
+	for n := 0; n < 10; n++ {
+		sim.AddEntity(&componentA{A: float64(n)})
+	}
+
+	// outside of a system every component is considered changed
+	query := NewQuery[struct {
+		A *componentA `ecs:"changed"`
+	}]()
+	assert.Len(t, query.Execute(sim).ToList(), 10)
+}
@@ -0,0 +1,36 @@
+package ecs
+
+import "time"
+
+// Clock provides the current time to a simulation.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is a Clock backed by the system's wall clock.
+var SystemClock Clock = systemClock{}
+
+// ManualClock is a Clock which only advances when told to, useful for driving a simulation
+// deterministically.
+type ManualClock struct {
+	now time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (m *ManualClock) Now() time.Time {
+	return m.now
+}
+
+// Advance moves the clock forward by the given duration.
+func (m *ManualClock) Advance(duration time.Duration) {
+	m.now = m.now.Add(duration)
+}
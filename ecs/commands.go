@@ -0,0 +1,139 @@
+package ecs
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+type commandKind uint8
+
+const (
+	commandSpawn commandKind = iota
+	commandDespawn
+	commandAddComponent
+	commandRemoveComponent
+)
+
+type command struct {
+	kind       commandKind
+	id         EntityId
+	components []interface{}
+}
+
+// SyncPoint controls when a simulation applies the commands recorded by its systems.
+type SyncPoint uint8
+
+const (
+	// SyncEndOfTick applies commands once every system has been updated.
+	SyncEndOfTick SyncPoint = iota
+	// SyncAfterSystem applies commands after each system has been updated, making
+	// structural changes visible to the systems that run after it within the same tick.
+	SyncAfterSystem
+)
+
+// CommandBuffer records structural changes (spawning and despawning entities, adding and
+// removing components) so they can be applied at a well-defined point instead of while
+// the storage is being iterated. It is safe to record commands from multiple systems at once.
+type CommandBuffer struct {
+	sim      *Simulation
+	lock     sync.Mutex
+	commands []command
+}
+
+func NewCommandBuffer(sim *Simulation) *CommandBuffer {
+	return &CommandBuffer{
+		sim:      sim,
+		commands: []command{},
+	}
+}
+
+// Spawn records the creation of a new entity with the given components. The returned id
+// is reserved immediately so it can be referenced by later commands within the buffer,
+// however the entity is not alive until the buffer is flushed. Components are checked as
+// they are recorded, returning an error wrapping ErrInvalidComponentType (and reserving no
+// id) if any are not of a registered component type.
+func (c *CommandBuffer) Spawn(components ...interface{}) (EntityId, error) {
+	resolved := make([]interface{}, len(components))
+	for index, component := range components {
+		pointer, _, err := resolveComponent(component)
+		if err != nil {
+			return 0, err
+		}
+		resolved[index] = pointer
+	}
+
+	id := c.sim.reserveEntity()
+	c.push(command{kind: commandSpawn, id: id, components: resolved})
+	return id, nil
+}
+
+// Despawn records the deletion of an entity.
+func (c *CommandBuffer) Despawn(id EntityId) {
+	c.push(command{kind: commandDespawn, id: id})
+}
+
+// AddComponent records adding a component to an entity, returning an error wrapping
+// ErrInvalidComponentType if the component is not of a registered component type.
+func (c *CommandBuffer) AddComponent(id EntityId, component interface{}) error {
+	pointer, _, err := resolveComponent(component)
+	if err != nil {
+		return err
+	}
+	c.push(command{kind: commandAddComponent, id: id, components: []interface{}{pointer}})
+	return nil
+}
+
+// RemoveComponent records removing a component from an entity.
+func (c *CommandBuffer) RemoveComponent(id EntityId, component interface{}) {
+	c.push(command{kind: commandRemoveComponent, id: id, components: []interface{}{component}})
+}
+
+func (c *CommandBuffer) push(command command) {
+	c.lock.Lock()
+	c.commands = append(c.commands, command)
+	c.lock.Unlock()
+}
+
+// clear discards every recorded command without applying it.
+func (c *CommandBuffer) clear() {
+	c.lock.Lock()
+	c.commands = []command{}
+	c.lock.Unlock()
+}
+
+// Len returns the number of commands waiting to be applied.
+func (c *CommandBuffer) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.commands)
+}
+
+// Flush applies all recorded commands to the simulation in the order they where recorded.
+// Adding components to entities which are not alive is ignored, components are checked as
+// they are recorded so no other command can fail.
+func (c *CommandBuffer) Flush() {
+	c.lock.Lock()
+	commands := c.commands
+	c.commands = []command{}
+	c.lock.Unlock()
+
+	for _, command := range commands {
+		switch command.kind {
+		case commandSpawn:
+			// reserved ids are only released once spawned, so this can only fail on a bug
+			if err := c.sim.spawnReserved(command.id, command.components...); err != nil {
+				log.Panicf("failed to spawn entity %v: %v", command.id, err)
+			}
+		case commandDespawn:
+			c.sim.DeleteEntity(command.id)
+		case commandAddComponent:
+			err := c.sim.TryAddComponent(command.id, command.components[0])
+			if err != nil && !errors.Is(err, ErrStaleEntity) && !errors.Is(err, ErrEntityNotFound) {
+				log.Panicf("failed to add component to entity %v: %v", command.id, err)
+			}
+		case commandRemoveComponent:
+			c.sim.RemoveComponent(command.id, command.components[0])
+		}
+	}
+}
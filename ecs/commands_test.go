@@ -0,0 +1,121 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testComponentQuery = NewQuery[struct {
+	Id   EntityId
+	Test *testComponent
+}]()
+
+// spawnerSystem despawns every entity with a testComponent while iterating them, spawning
+// a replacement which references another entity spawned within the same buffer.
+type spawnerSystem struct{}
+
+func (s *spawnerSystem) Update(frame *SimulationFrame) {
+	result := testComponentQuery.Execute(frame.Sim)
+	for result.Next() {
+		frame.Commands.Despawn(result.Item.Id)
+
+		id, _ := frame.Commands.Spawn(&testComponent{a: result.Item.Test.a + 1})
+		frame.Commands.AddComponent(id, &otherComponent{x: int(result.Item.Test.a)})
+	}
+}
+
+func (s *spawnerSystem) Render(frame *SimulationFrame) {}
+
+// counterSystem records how many entities with an otherComponent it observes.
+type counterSystem struct {
+	counts []int
+}
+
+func (c *counterSystem) Update(frame *SimulationFrame) {
+	c.counts = append(c.counts, len(NewQuery[struct{ Other *otherComponent }]().Execute(frame.Sim).ToList()))
+}
+
+func (c *counterSystem) Render(frame *SimulationFrame) {}
+
+func TestCommandBufferDeferredUntilFlush(t *testing.T) {
+	sim := NewSimpleSimulation()
+	ids := []EntityId{}
+	for n := 0; n < 10; n++ {
+		ids = append(ids, sim.AddEntity(&testComponent{a: int32(n)}))
+	}
+
+	spawned, err := sim.Frame.Commands.Spawn(&testComponent{a: 100})
+	assert.NoError(t, err)
+	assert.NoError(t, sim.Frame.Commands.AddComponent(spawned, &otherComponent{x: 100}))
+	sim.Frame.Commands.Despawn(ids[0])
+	sim.Frame.Commands.RemoveComponent(ids[1], testComponent{})
+	assert.Equal(t, 4, sim.Frame.Commands.Len())
+
+	assert.False(t, sim.IsAlive(spawned), "spawned entity should not be alive until flushed")
+	assert.True(t, sim.IsAlive(ids[0]), "despawned entity should be alive until flushed")
+	assert.Len(t, testComponentQuery.Execute(sim).ToList(), 10)
+
+	sim.Frame.Commands.Flush()
+	assert.Equal(t, 0, sim.Frame.Commands.Len())
+	assert.True(t, sim.IsAlive(spawned), "spawned entity should be alive once flushed")
+	assert.False(t, sim.IsAlive(ids[0]), "despawned entity should not be alive once flushed")
+
+	var other otherComponent
+	assert.True(t, sim.GetComponent(spawned, &other), "component added to spawned entity should exist")
+	assert.Equal(t, 100, other.x)
+
+	var test testComponent
+	assert.False(t, sim.GetComponent(ids[1], &test), "removed component should not exist")
+	assert.Len(t, testComponentQuery.Execute(sim).ToList(), 9)
+}
+
+func TestCommandBufferErrors(t *testing.T) {
+	sim := NewSimpleSimulation()
+	id := sim.AddEntity(&testComponent{})
+
+	// invalid components are reported as they are recorded, rather than once flushed
+	_, err := sim.Frame.Commands.Spawn(&testComponent{}, &unregisteredComponent{})
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+	assert.ErrorIs(t, sim.Frame.Commands.AddComponent(id, 5), ErrInvalidComponentType)
+	assert.Equal(t, 0, sim.Frame.Commands.Len())
+
+	// adding components to entities which are not alive is ignored
+	assert.NoError(t, sim.Frame.Commands.AddComponent(NewEntityId(1000, 0), &otherComponent{}))
+	sim.Frame.Commands.Despawn(id)
+	assert.NoError(t, sim.Frame.Commands.AddComponent(id, &otherComponent{}))
+	assert.NotPanics(t, sim.Frame.Commands.Flush)
+	assert.False(t, sim.IsAlive(id))
+}
+
+func TestCommandBufferSyncPoints(t *testing.T) {
+	for _, syncPoint := range []SyncPoint{SyncEndOfTick, SyncAfterSystem} {
+		executor := NewSequentialSystemExecutor()
+		counter := &counterSystem{}
+		executor.Add(&spawnerSystem{}, counter)
+
+		sim := NewSimulation(NewEntitySimpleStorage(), executor)
+		sim.SyncPoint = syncPoint
+		for n := 0; n < 10; n++ {
+			sim.AddEntity(&testComponent{a: int32(n)})
+		}
+
+		sim.Update()
+		if syncPoint == SyncEndOfTick {
+			assert.Equal(t, []int{0}, counter.counts, "commands should not be visible within the same tick")
+		} else {
+			assert.Equal(t, []int{10}, counter.counts, "replacement entities should be visible after the spawner")
+		}
+
+		// every entity was replaced exactly once
+		result := NewQuery[struct {
+			Test  *testComponent
+			Other *otherComponent
+		}]().Execute(sim).ToList()
+		assert.Len(t, result, 10)
+		for _, item := range result {
+			assert.Equal(t, int32(item.Other.x+1), item.Test.a)
+		}
+		assert.Equal(t, 0, sim.Frame.Commands.Len(), "commands should be flushed at the end of the tick")
+	}
+}
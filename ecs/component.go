@@ -11,3 +11,15 @@ type LabelComponent struct {
 }
 
 type Component = any
+
+/// ParentComponent is the parent of an entity within a hierarchy. It is managed by the
+///  simulation through SetParent and should not be added directly.
+type ParentComponent struct {
+	Parent EntityId
+}
+
+/// ChildrenComponent lists the children of an entity in the order they where parented. It
+///  is managed by the simulation through SetParent and should not be added directly.
+type ChildrenComponent struct {
+	Children []EntityId
+}
@@ -0,0 +1,17 @@
+package ecs
+
+import "errors"
+
+var (
+	// ErrEntityNotFound is returned for entity ids which do not refer to any entity.
+	ErrEntityNotFound = errors.New("entity not found")
+	// ErrStaleEntity is returned for entity ids whose entity has since been deleted.
+	ErrStaleEntity = errors.New("stale entity")
+	// ErrDuplicateEntity is returned when adding an entity to storage which already exists.
+	ErrDuplicateEntity = errors.New("duplicate entity")
+	// ErrInvalidComponentType is returned for components (or query fields) which are not
+	// structs, or pointers to structs, of a registered component type.
+	ErrInvalidComponentType = errors.New("invalid component type")
+	// ErrComponentNotFound is returned when an entity does not have the requested component.
+	ErrComponentNotFound = errors.New("component not found")
+)
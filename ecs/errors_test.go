@@ -0,0 +1,82 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulationTryEntities(t *testing.T) {
+	sim := NewSimpleSimulation()
+
+	id, err := sim.TryAddEntity(&testComponent{a: 1})
+	assert.NoError(t, err)
+	_, err = sim.TryAddEntity(&testComponent{}, &unregisteredComponent{})
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+	assert.Len(t, NewQuery[AllEntities]().Execute(sim).ToList(), 1, "invalid entities should not be added")
+
+	assert.ErrorIs(t, sim.TryDeleteEntity(0), ErrEntityNotFound)
+	assert.ErrorIs(t, sim.TryDeleteEntity(NewEntityId(100, 0)), ErrEntityNotFound)
+	assert.NoError(t, sim.TryDeleteEntity(id))
+	assert.ErrorIs(t, sim.TryDeleteEntity(id), ErrStaleEntity)
+
+	// the recycled slot should not make the old id valid again
+	recycled := sim.AddEntity(&testComponent{})
+	assert.Equal(t, id.Index(), recycled.Index())
+	assert.ErrorIs(t, sim.TryAddComponent(id, &otherComponent{}), ErrStaleEntity)
+	assert.NotPanics(t, func() { sim.AddComponent(id, &otherComponent{}) }, "stale ids should be ignored")
+	assert.Panics(t, func() { sim.AddComponent(recycled, &unregisteredComponent{}) })
+	assert.ErrorIs(t, sim.SetParent(id, recycled), ErrStaleEntity)
+	assert.ErrorIs(t, AddRelation[likesRelation](sim, recycled, id), ErrStaleEntity)
+}
+
+func TestSimulationTryComponents(t *testing.T) {
+	sim := NewSimpleSimulation()
+	id := sim.AddEntity(&testComponent{a: 5})
+
+	var test testComponent
+	assert.NoError(t, sim.TryGetComponent(id, &test))
+	assert.Equal(t, int32(5), test.a)
+	assert.ErrorIs(t, sim.TryGetComponent(id, &otherComponent{}), ErrComponentNotFound)
+	assert.ErrorIs(t, sim.TryGetComponent(id, testComponent{}), ErrInvalidComponentType)
+	assert.ErrorIs(t, sim.TryGetComponent(id, &unregisteredComponent{}), ErrInvalidComponentType)
+	assert.ErrorIs(t, sim.TryGetComponent(NewEntityId(100, 0), &test), ErrEntityNotFound)
+
+	assert.ErrorIs(t, sim.TryRemoveComponent(id, 5), ErrInvalidComponentType)
+	assert.ErrorIs(t, sim.TryRemoveComponent(id, otherComponent{}), ErrComponentNotFound)
+	assert.NoError(t, sim.TryRemoveComponent(id, testComponent{}))
+	assert.False(t, sim.GetComponent(id, &test))
+
+	sim.DeleteEntity(id)
+	assert.ErrorIs(t, sim.TryGetComponent(id, &test), ErrStaleEntity)
+	assert.ErrorIs(t, sim.TryRemoveComponent(id, &testComponent{}), ErrStaleEntity)
+}
+
+func TestTryNewQuery(t *testing.T) {
+	query, err := TryNewQuery[struct{ Test *testComponent }]()
+	assert.NoError(t, err)
+	assert.NotNil(t, query)
+
+	_, err = TryNewQuery[int]()
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+	_, err = TryNewQuery[struct{ Test testComponent }]()
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+	_, err = TryNewQuery[struct {
+		First  EntityId
+		Second EntityId
+	}]()
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+
+	// added and changed require the component, so they can not be optional
+	_, err = TryNewQuery[struct {
+		Test *testComponent `ecs:"optional,added"`
+	}]()
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+	_, err = TryNewQuery[struct {
+		Test  *testComponent  `ecs:"anyof=a,changed"`
+		Other *otherComponent `ecs:"anyof=a"`
+	}]()
+	assert.ErrorIs(t, err, ErrInvalidComponentType)
+
+	assert.Panics(t, func() { NewQuery[int]() })
+}
@@ -0,0 +1,155 @@
+package ecs
+
+import (
+	"log"
+	"reflect"
+	"sync"
+)
+
+// eventBuffer is a double-buffered queue of events. Events are kept for two updates, after
+// which they are dropped, giving every system a chance to read events sent after it ran.
+// Readers keep their own cursor into the buffer so that they never steal events from each
+// other.
+type eventBuffer[T any] struct {
+	lock     sync.Mutex
+	previous []T
+	current  []T
+	// start is the sequence number of the first event within previous
+	start uint64
+}
+
+func newEventBuffer[T any]() *eventBuffer[T] {
+	return &eventBuffer[T]{
+		previous: []T{},
+		current:  []T{},
+	}
+}
+
+func (b *eventBuffer[T]) push(events ...T) {
+	b.lock.Lock()
+	b.current = append(b.current, events...)
+	b.lock.Unlock()
+}
+
+// read returns every event after the cursor, advancing it past them. Events which where
+// dropped before the cursor reached them are skipped.
+func (b *eventBuffer[T]) read(cursor *uint64) []T {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if *cursor < b.start {
+		*cursor = b.start
+	}
+
+	result := []T{}
+	offset := int(*cursor - b.start)
+	if offset < len(b.previous) {
+		result = append(result, b.previous[offset:]...)
+		offset = 0
+	} else {
+		offset -= len(b.previous)
+	}
+	if offset < len(b.current) {
+		result = append(result, b.current[offset:]...)
+	}
+
+	*cursor = b.start + uint64(len(b.previous)+len(b.current))
+	return result
+}
+
+// swap drops the events from the previous update, called once at the end of every update.
+func (b *eventBuffer[T]) swap() {
+	b.lock.Lock()
+	b.start += uint64(len(b.previous))
+	b.previous = b.current
+	b.current = []T{}
+	b.lock.Unlock()
+}
+
+// eventSwapper is implemented by every Events[T], allowing the simulation to swap the
+// buffers of each event type without knowing it.
+type eventSwapper interface {
+	swap()
+}
+
+// Events is the buffer of events of type T sent between systems. Events live for two
+// updates, so every system gets a chance to read an event regardless of whether it runs
+// before or after the system that sent it.
+type Events[T any] struct {
+	buffer *eventBuffer[T]
+}
+
+func (e *Events[T]) swap() {
+	e.buffer.swap()
+}
+
+// Send queues events to be read by every reader. It is safe to send events from multiple
+// systems at once.
+func (e *Events[T]) Send(events ...T) {
+	e.buffer.push(events...)
+}
+
+// Read returns every event sent since the reader last read, advancing the reader.
+func (e *Events[T]) Read(reader *EventReader[T]) []T {
+	return e.buffer.read(&reader.cursor)
+}
+
+// EventReader is the position of a single reader within Events[T]. Systems should keep their
+// own reader so that they see every event exactly once, without stealing events from other
+// readers.
+type EventReader[T any] struct {
+	cursor uint64
+}
+
+// RegisterEvent registers the event type T with the simulation, returning its events. It is
+// intended to be called from the Setup of the systems sending or reading the event, and
+// registering the same type more than once returns the existing events.
+func RegisterEvent[T any](sim *Simulation) *Events[T] {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+
+	sim.eventLock.Lock()
+	defer sim.eventLock.Unlock()
+
+	if existing, exists := sim.events[eventType]; exists {
+		return existing.(*Events[T])
+	}
+
+	events := &Events[T]{buffer: newEventBuffer[T]()}
+	sim.events[eventType] = events
+	return events
+}
+
+// GetEvents returns the events of type T, panicking if the type was never registered.
+func GetEvents[T any](sim *Simulation) *Events[T] {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+
+	sim.eventLock.RLock()
+	events, exists := sim.events[eventType]
+	sim.eventLock.RUnlock()
+
+	if !exists {
+		log.Panicf("event type %v was not registered", eventType)
+	}
+	return events.(*Events[T])
+}
+
+// SendEvent sends events of type T, which must have been registered with RegisterEvent.
+func SendEvent[T any](sim *Simulation, events ...T) {
+	GetEvents[T](sim).Send(events...)
+}
+
+// ReadEvents returns the events of type T sent since the reader last read, which must have
+// been registered with RegisterEvent.
+func ReadEvents[T any](sim *Simulation, reader *EventReader[T]) []T {
+	return GetEvents[T](sim).Read(reader)
+}
+
+func (s *Simulation) swapEvents() {
+	s.eventLock.RLock()
+	defer s.eventLock.RUnlock()
+
+	for _, events := range s.events {
+		events.swap()
+	}
+	s.removals.swap()
+}
@@ -0,0 +1,96 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type damageEvent struct {
+	target EntityId
+	amount int
+}
+
+// damageSenderSystem sends a damage event every update.
+type damageSenderSystem struct {
+	sent int
+}
+
+func (d *damageSenderSystem) Setup(sim *Simulation) error {
+	RegisterEvent[damageEvent](sim)
+	return nil
+}
+
+func (d *damageSenderSystem) Update(frame *SimulationFrame) {
+	d.sent += 1
+	SendEvent(frame.Sim, damageEvent{amount: d.sent})
+}
+
+func (d *damageSenderSystem) Render(frame *SimulationFrame) {}
+
+// damageReaderSystem records the damage events it reads each update.
+type damageReaderSystem struct {
+	reader EventReader[damageEvent]
+	read   [][]int
+}
+
+func (d *damageReaderSystem) Setup(sim *Simulation) error {
+	RegisterEvent[damageEvent](sim)
+	return nil
+}
+
+func (d *damageReaderSystem) Update(frame *SimulationFrame) {
+	amounts := []int{}
+	for _, event := range ReadEvents(frame.Sim, &d.reader) {
+		amounts = append(amounts, event.amount)
+	}
+	d.read = append(d.read, amounts)
+}
+
+func (d *damageReaderSystem) Render(frame *SimulationFrame) {}
+
+func TestEvents(t *testing.T) {
+	before := &damageReaderSystem{}
+	after := &damageReaderSystem{}
+
+	sim := NewSimpleSimulation()
+	sim.Executor.(*SequentialSystemExecutor).Add(before, &damageSenderSystem{}, after)
+	assert.NoError(t, sim.Setup())
+
+	for n := 0; n < 3; n++ {
+		sim.Update()
+	}
+
+	// readers which run before the sender see its events on the following update
+	assert.Equal(t, [][]int{{}, {1}, {2}}, before.read)
+	assert.Equal(t, [][]int{{1}, {2}, {3}}, after.read)
+}
+
+func TestEventsLifetime(t *testing.T) {
+	sim := NewSimpleSimulation()
+	events := RegisterEvent[damageEvent](sim)
+	assert.Same(t, events, RegisterEvent[damageEvent](sim), "registering twice should return the same events")
+
+	first := EventReader[damageEvent]{}
+	second := EventReader[damageEvent]{}
+	late := EventReader[damageEvent]{}
+
+	SendEvent(sim, damageEvent{amount: 1}, damageEvent{amount: 2})
+	assert.Len(t, ReadEvents(sim, &first), 2)
+	assert.Len(t, ReadEvents(sim, &first), 0, "readers should only see each event once")
+
+	sim.Update()
+	SendEvent(sim, damageEvent{amount: 3})
+	assert.Equal(t, []damageEvent{{amount: 3}}, ReadEvents(sim, &first))
+	assert.Len(t, ReadEvents(sim, &second), 3, "readers should not steal events from each other")
+
+	sim.Update()
+	assert.Equal(t, []damageEvent{{amount: 3}}, ReadEvents(sim, &late), "events should be dropped after two updates")
+}
+
+func TestEventsUnregistered(t *testing.T) {
+	sim := NewSimpleSimulation()
+	assert.Panics(t, func() {
+		SendEvent(sim, damageEvent{})
+	})
+}
@@ -1,5 +1,10 @@
 package ecs
 
+import (
+	"log"
+	"reflect"
+)
+
 type SystemSetup interface {
 	Setup(*Simulation) error
 }
@@ -9,6 +14,24 @@ type System interface {
 	Render(*SimulationFrame)
 }
 
+// SystemAccess describes the component and resource types a system reads and writes,
+// allowing executors to run systems which do not conflict concurrently. Component types may
+// be given either as the struct type or a pointer to it, while resource types are given as
+// the type passed to InsertResource.
+type SystemAccess struct {
+	Read  []reflect.Type
+	Write []reflect.Type
+
+	ReadResources  []reflect.Type
+	WriteResources []reflect.Type
+}
+
+// SystemAccessor may be implemented by systems to declare the components they access. Systems
+// which do not implement it have their access inferred from the queries stored on them.
+type SystemAccessor interface {
+	Access() SystemAccess
+}
+
 type SystemExecutor interface {
 	System
 
@@ -16,17 +39,47 @@ type SystemExecutor interface {
 	All() []System
 }
 
-/// SequentialSystemExecutor executes systems sequentially in the order they where
-///  added.
+/// SequentialSystemExecutor executes systems sequentially, ordered by their stage and
+///  ordering constraints, and otherwise in the order they where added.
 type SequentialSystemExecutor struct {
+	// Stages lists the stages systems may be placed in, in the order they run.
+	Stages []Stage
+
+	entries []*scheduledSystem
+	sorted  []*scheduledSystem
 	systems []System
+	dirty   bool
 }
 
 func NewSequentialSystemExecutor() *SequentialSystemExecutor {
-	return &SequentialSystemExecutor{systems: []System{}}
+	return &SequentialSystemExecutor{
+		Stages:  append([]Stage{}, DefaultStages...),
+		entries: []*scheduledSystem{},
+		sorted:  []*scheduledSystem{},
+		systems: []System{},
+	}
+}
+
+func (s *SequentialSystemExecutor) schedule() error {
+	sorted, err := sortSystems(s.entries, s.Stages)
+	if err != nil {
+		return err
+	}
+
+	s.sorted = sorted
+	s.systems = make([]System, len(sorted))
+	for index, entry := range sorted {
+		s.systems[index] = entry.system
+	}
+	s.dirty = false
+	return nil
 }
 
 func (s *SequentialSystemExecutor) Setup(sim *Simulation) error {
+	if err := s.schedule(); err != nil {
+		return err
+	}
+
 	for _, system := range s.systems {
 		if setupSystem, ok := system.(SystemSetup); ok {
 			err := setupSystem.Setup(sim)
@@ -39,8 +92,15 @@ func (s *SequentialSystemExecutor) Setup(sim *Simulation) error {
 }
 
 func (s *SequentialSystemExecutor) Update(frame *SimulationFrame) {
-	for _, system := range s.systems {
-		system.Update(frame)
+	if s.dirty {
+		if err := s.schedule(); err != nil {
+			log.Panicf("failed to schedule systems: %v", err)
+		}
+	}
+
+	for _, entry := range s.sorted {
+		entry.update(frame, frame.Sim.Storage.AdvanceChangeTick())
+		frame.AfterSystemUpdate()
 	}
 }
 
@@ -51,9 +111,19 @@ func (s *SequentialSystemExecutor) Render(frame *SimulationFrame) {
 }
 
 func (s *SequentialSystemExecutor) Add(systems ...System) {
-	s.systems = append(s.systems, systems...)
+	for _, system := range systems {
+		s.AddWithConfig(system, SystemConfig{})
+	}
+}
+
+// AddWithConfig adds a system which is placed within the schedule based on the given config.
+func (s *SequentialSystemExecutor) AddWithConfig(system System, config SystemConfig) {
+	s.entries = append(s.entries, &scheduledSystem{system: system, config: config, order: len(s.entries)})
+	s.systems = append(s.systems, system)
+	s.dirty = true
 }
 
+// All returns every system, in the order they run once the executor has been setup.
 func (s *SequentialSystemExecutor) All() []System {
 	return s.systems
 }
@@ -0,0 +1,281 @@
+package ecs
+
+import (
+	"log"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// queryAccessor is implemented by every Query, allowing executors to infer the access of
+// systems which store their queries as fields.
+type queryAccessor interface {
+	Access() SystemAccess
+}
+
+// systemAccess is the normalized access of a single system.
+type systemAccess struct {
+	exclusive      bool
+	read           map[reflect.Type]struct{}
+	write          map[reflect.Type]struct{}
+	readResources  map[reflect.Type]struct{}
+	writeResources map[reflect.Type]struct{}
+}
+
+func normalizeComponentType(componentType reflect.Type) reflect.Type {
+	if componentType.Kind() == reflect.Struct {
+		return reflect.PointerTo(componentType)
+	}
+	return componentType
+}
+
+func newSystemAccess(access SystemAccess) *systemAccess {
+	result := &systemAccess{
+		read:           map[reflect.Type]struct{}{},
+		write:          map[reflect.Type]struct{}{},
+		readResources:  map[reflect.Type]struct{}{},
+		writeResources: map[reflect.Type]struct{}{},
+	}
+	result.merge(access)
+	return result
+}
+
+func (a *systemAccess) merge(access SystemAccess) {
+	for _, componentType := range access.Read {
+		a.read[normalizeComponentType(componentType)] = struct{}{}
+	}
+	for _, componentType := range access.Write {
+		a.write[normalizeComponentType(componentType)] = struct{}{}
+	}
+	for _, resourceType := range access.ReadResources {
+		a.readResources[resourceType] = struct{}{}
+	}
+	for _, resourceType := range access.WriteResources {
+		a.writeResources[resourceType] = struct{}{}
+	}
+}
+
+// conflicts returns whether two systems may not run at the same time, which is the case if
+// either writes a component or resource the other accesses.
+func (a *systemAccess) conflicts(other *systemAccess) bool {
+	if a.exclusive || other.exclusive {
+		return true
+	}
+
+	return writeConflicts(a.write, other.read, other.write) ||
+		writeConflicts(other.write, a.read, a.write) ||
+		writeConflicts(a.writeResources, other.readResources, other.writeResources) ||
+		writeConflicts(other.writeResources, a.readResources, a.writeResources)
+}
+
+// writeConflicts returns whether any of the written types are read or written by another system.
+func writeConflicts(write map[reflect.Type]struct{}, otherRead map[reflect.Type]struct{}, otherWrite map[reflect.Type]struct{}) bool {
+	for writeType := range write {
+		if _, exists := otherRead[writeType]; exists {
+			return true
+		}
+		if _, exists := otherWrite[writeType]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// accessOf returns the declared access of a system, falling back to inferring it from any
+// queries stored within the system's fields. Systems without any known access are treated
+// as exclusive.
+func accessOf(system System) *systemAccess {
+	if accessor, ok := system.(SystemAccessor); ok {
+		return newSystemAccess(accessor.Access())
+	}
+
+	result := newSystemAccess(SystemAccess{})
+	found := false
+
+	value := reflect.ValueOf(system)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Struct {
+		for fieldIdx := 0; fieldIdx < value.NumField(); fieldIdx++ {
+			field := value.Field(fieldIdx)
+			if field.Kind() != reflect.Pointer || field.IsNil() || !field.CanInterface() {
+				continue
+			}
+
+			if query, ok := field.Interface().(queryAccessor); ok {
+				result.merge(query.Access())
+				found = true
+			}
+		}
+	}
+
+	result.exclusive = !found
+	return result
+}
+
+/// ParallelSystemExecutor runs systems which do not access conflicting components
+///  concurrently on a pool of workers. Systems which do conflict are run in the order they
+///  where added, and stages and ordering constraints are respected. Systems may declare
+///  their access by implementing SystemAccessor, otherwise it is inferred from the queries
+///  stored as fields on the system. Systems without either are run on their own. Resources
+///  are never inferred, so systems accessing them must implement SystemAccessor.
+///
+///  Systems run by this executor must not structurally modify the simulation directly and
+///  should instead record changes through the frame's CommandBuffer. With SyncAfterSystem
+///  commands are applied after each batch of concurrently run systems. Render is always
+///  called sequentially. Systems within a batch share the same change tick.
+type ParallelSystemExecutor struct {
+	// Workers is the maximum number of systems updated at once, defaulting to GOMAXPROCS.
+	Workers int
+	// Stages lists the stages systems may be placed in, in the order they run.
+	Stages []Stage
+
+	entries []*scheduledSystem
+	systems []System
+	batches [][]*scheduledSystem
+	dirty   bool
+}
+
+func NewParallelSystemExecutor() *ParallelSystemExecutor {
+	return &ParallelSystemExecutor{
+		Workers: runtime.GOMAXPROCS(0),
+		Stages:  append([]Stage{}, DefaultStages...),
+		entries: []*scheduledSystem{},
+		systems: []System{},
+		batches: [][]*scheduledSystem{},
+	}
+}
+
+// schedule groups systems into batches where no two systems within a batch conflict. Each
+// system is placed in the batch following the last batch containing a conflicting system or
+// a system it must run after, and never before a batch of an earlier stage.
+func (p *ParallelSystemExecutor) schedule() error {
+	sorted, err := sortSystems(p.entries, p.Stages)
+	if err != nil {
+		return err
+	}
+
+	accesses := make([]*systemAccess, len(sorted))
+	levels := make(map[*scheduledSystem]int, len(sorted))
+	p.systems = make([]System, len(sorted))
+	p.batches = [][]*scheduledSystem{}
+
+	stageStart := 0
+	for index, entry := range sorted {
+		if index > 0 && entry.stage() != sorted[index-1].stage() {
+			stageStart = len(p.batches)
+		}
+		accesses[index] = accessOf(entry.system)
+
+		level := stageStart
+		for previous := 0; previous < index; previous++ {
+			if levels[sorted[previous]] >= level && accesses[index].conflicts(accesses[previous]) {
+				level = levels[sorted[previous]] + 1
+			}
+		}
+		for _, dependency := range entry.dependencies {
+			if levels[dependency] >= level {
+				level = levels[dependency] + 1
+			}
+		}
+
+		levels[entry] = level
+		for level >= len(p.batches) {
+			p.batches = append(p.batches, []*scheduledSystem{})
+		}
+		p.batches[level] = append(p.batches[level], entry)
+		p.systems[index] = entry.system
+	}
+
+	p.dirty = false
+	return nil
+}
+
+func (p *ParallelSystemExecutor) Setup(sim *Simulation) error {
+	if err := p.schedule(); err != nil {
+		return err
+	}
+
+	for _, system := range p.systems {
+		if setupSystem, ok := system.(SystemSetup); ok {
+			err := setupSystem.Setup(sim)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *ParallelSystemExecutor) Update(frame *SimulationFrame) {
+	if p.dirty {
+		if err := p.schedule(); err != nil {
+			log.Panicf("failed to schedule systems: %v", err)
+		}
+	}
+
+	for _, batch := range p.batches {
+		p.runBatch(frame, batch)
+		frame.AfterSystemUpdate()
+	}
+}
+
+func (p *ParallelSystemExecutor) runBatch(frame *SimulationFrame, batch []*scheduledSystem) {
+	tick := frame.Sim.Storage.AdvanceChangeTick()
+	if len(batch) == 1 {
+		batch[0].update(frame, tick)
+		return
+	}
+
+	workers := p.Workers
+	if workers <= 0 || workers > len(batch) {
+		workers = len(batch)
+	}
+
+	work := make(chan *scheduledSystem, len(batch))
+	for _, entry := range batch {
+		work <- entry
+	}
+	close(work)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer wg.Done()
+			for entry := range work {
+				entry.update(frame, tick)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *ParallelSystemExecutor) Render(frame *SimulationFrame) {
+	for _, system := range p.systems {
+		system.Render(frame)
+	}
+}
+
+func (p *ParallelSystemExecutor) Add(systems ...System) {
+	for _, system := range systems {
+		p.AddWithConfig(system, SystemConfig{})
+	}
+}
+
+// AddWithConfig adds a system which is placed within the schedule based on the given config.
+func (p *ParallelSystemExecutor) AddWithConfig(system System, config SystemConfig) {
+	p.entries = append(p.entries, &scheduledSystem{system: system, config: config, order: len(p.entries)})
+	p.systems = append(p.systems, system)
+	p.dirty = true
+}
+
+// All returns every system, in the order they run once the executor has been setup.
+func (p *ParallelSystemExecutor) All() []System {
+	return p.systems
+}
@@ -0,0 +1,176 @@
+package ecs
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rendezvousSystem waits for a partner system to start, which can only happen if both are
+// run concurrently.
+type rendezvousSystem struct {
+	access     SystemAccess
+	started    chan struct{}
+	partner    chan struct{}
+	overlapped bool
+}
+
+func (r *rendezvousSystem) Access() SystemAccess {
+	return r.access
+}
+
+func (r *rendezvousSystem) Update(frame *SimulationFrame) {
+	close(r.started)
+	select {
+	case <-r.partner:
+		r.overlapped = true
+	case <-time.After(time.Second):
+	}
+}
+
+func (r *rendezvousSystem) Render(frame *SimulationFrame) {}
+
+// orderedSystem records its name within a shared log when updated.
+type orderedSystem struct {
+	name  string
+	query *Query[struct{ Test *testComponent }]
+	lock  *sync.Mutex
+	log   *[]string
+}
+
+func (o *orderedSystem) Update(frame *SimulationFrame) {
+	for result := o.query.Execute(frame.Sim); result.Next(); {
+		result.Item.Test.a += 1
+	}
+
+	o.lock.Lock()
+	*o.log = append(*o.log, o.name)
+	o.lock.Unlock()
+}
+
+func (o *orderedSystem) Render(frame *SimulationFrame) {}
+
+// readOnlySystem only reads components through a query stored on the system.
+type readOnlySystem struct {
+	query *Query[struct {
+		Test *testComponent `ecs:"read"`
+	}]
+}
+
+func (r *readOnlySystem) Update(frame *SimulationFrame) {}
+
+func (r *readOnlySystem) Render(frame *SimulationFrame) {}
+
+func TestParallelExecutorOverlapsDisjointSystems(t *testing.T) {
+	first := &rendezvousSystem{
+		access:  SystemAccess{Write: []reflect.Type{reflect.TypeOf(testComponent{})}},
+		started: make(chan struct{}),
+	}
+	second := &rendezvousSystem{
+		access:  SystemAccess{Write: []reflect.Type{reflect.TypeOf(&otherComponent{})}},
+		started: make(chan struct{}),
+	}
+	first.partner = second.started
+	second.partner = first.started
+
+	executor := NewParallelSystemExecutor()
+	executor.Workers = 2
+	executor.Add(first, second)
+
+	sim := NewSimulation(NewEntitySimpleStorage(), executor)
+	assert.NoError(t, sim.Setup())
+	sim.Update()
+
+	assert.True(t, first.overlapped, "disjoint systems should run concurrently")
+	assert.True(t, second.overlapped, "disjoint systems should run concurrently")
+}
+
+func TestParallelExecutorPreservesConflictingOrder(t *testing.T) {
+	var lock sync.Mutex
+	log := []string{}
+	system := func(name string) *orderedSystem {
+		return &orderedSystem{
+			name:  name,
+			query: NewQuery[struct{ Test *testComponent }](),
+			lock:  &lock,
+			log:   &log,
+		}
+	}
+
+	executor := NewParallelSystemExecutor()
+	executor.Add(system("a"), system("b"), system("c"))
+
+	sim := NewSimulation(NewEntitySimpleStorage(), executor)
+	for n := 0; n < 100; n++ {
+		sim.AddEntity(&testComponent{})
+	}
+	assert.NoError(t, sim.Setup())
+
+	for n := 0; n < 10; n++ {
+		sim.Update()
+	}
+
+	expected := []string{}
+	for n := 0; n < 10; n++ {
+		expected = append(expected, "a", "b", "c")
+	}
+	assert.Equal(t, expected, log, "systems writing the same component should run in add order")
+	for _, item := range NewQuery[struct{ Test *testComponent }]().Execute(sim).ToList() {
+		assert.Equal(t, int32(30), item.Test.a)
+	}
+}
+
+func TestParallelExecutorSchedule(t *testing.T) {
+	testType := reflect.TypeOf(&testComponent{})
+	otherType := reflect.TypeOf(&otherComponent{})
+
+	readTest := &rendezvousSystem{access: SystemAccess{Read: []reflect.Type{testType}}}
+	readTestAgain := &rendezvousSystem{access: SystemAccess{Read: []reflect.Type{testType}}}
+	writeOther := &rendezvousSystem{access: SystemAccess{Write: []reflect.Type{otherType}}}
+	writeTest := &rendezvousSystem{access: SystemAccess{Read: []reflect.Type{otherType}, Write: []reflect.Type{testType}}}
+	exclusive := &counterSystem{}
+	inferred := &readOnlySystem{query: NewQuery[struct {
+		Test *testComponent `ecs:"read"`
+	}]()}
+	inferredWrite := &orderedSystem{query: NewQuery[struct{ Test *testComponent }]()}
+
+	executor := NewParallelSystemExecutor()
+	executor.Add(readTest, readTestAgain, writeOther, writeTest, exclusive, inferred, inferredWrite)
+	assert.NoError(t, executor.schedule())
+
+	assert.Equal(t, [][]System{
+		{readTest, readTestAgain, writeOther},
+		{writeTest},
+		{exclusive},
+		{inferred},
+		{inferredWrite},
+	}, batchedSystems(executor))
+}
+
+func batchedSystems(executor *ParallelSystemExecutor) [][]System {
+	result := make([][]System, len(executor.batches))
+	for index, batch := range executor.batches {
+		for _, entry := range batch {
+			result[index] = append(result[index], entry.system)
+		}
+	}
+	return result
+}
+
+func TestParallelExecutorCommands(t *testing.T) {
+	executor := NewParallelSystemExecutor()
+	for n := 0; n < 8; n++ {
+		executor.Add(&spawnerSystem{})
+	}
+
+	sim := NewSimulation(NewEntitySimpleStorage(), executor)
+	sim.AddEntity(&testComponent{})
+	assert.NoError(t, sim.Setup())
+	sim.Update()
+
+	// every spawner is exclusive, so each despawns the entity and spawns a replacement
+	assert.Len(t, NewQuery[struct{ Test *testComponent }]().Execute(sim).ToList(), 8)
+}
@@ -0,0 +1,113 @@
+package ecs
+
+import (
+	"fmt"
+)
+
+// Parent returns the parent of an entity, or false if it has none.
+func (s *Simulation) Parent(id EntityId) (EntityId, bool) {
+	if !s.IsAlive(id) {
+		return 0, false
+	}
+
+	parent, ok := s.Storage.GetComponent(id, parentComponentId).(*ParentComponent)
+	if !ok {
+		return 0, false
+	}
+	return parent.Parent, true
+}
+
+// Children returns the children of an entity in the order they where parented.
+func (s *Simulation) Children(id EntityId) []EntityId {
+	if !s.IsAlive(id) {
+		return []EntityId{}
+	}
+
+	children, ok := s.Storage.GetComponent(id, childrenComponentId).(*ChildrenComponent)
+	if !ok {
+		return []EntityId{}
+	}
+	return append([]EntityId{}, children.Children...)
+}
+
+// SetParent makes child the last child of parent, removing it from its previous parent. An
+// error is returned if either entity is not alive or if the parent is a descendant of (or
+// is) the child.
+func (s *Simulation) SetParent(child EntityId, parent EntityId) error {
+	if err := s.checkEntity(child); err != nil {
+		return fmt.Errorf("cannot set parent of entity %v: %w", child, err)
+	}
+	if err := s.checkEntity(parent); err != nil {
+		return fmt.Errorf("cannot set parent of entity %v to entity %v: %w", child, parent, err)
+	}
+
+	for ancestor, ok := parent, true; ok; ancestor, ok = s.Parent(ancestor) {
+		if ancestor == child {
+			return fmt.Errorf("cannot set parent of entity %v to entity %v as it would create a cycle", child, parent)
+		}
+	}
+
+	if current, ok := s.Parent(child); ok && current == parent {
+		return nil
+	}
+	s.detachFromParent(child)
+
+	if err := s.TryAddComponent(child, &ParentComponent{Parent: parent}); err != nil {
+		return err
+	}
+	if children, ok := s.Storage.GetComponent(parent, childrenComponentId).(*ChildrenComponent); ok {
+		children.Children = append(children.Children, child)
+		s.Storage.MarkChanged(parent, childrenComponentId)
+		return nil
+	}
+	return s.TryAddComponent(parent, &ChildrenComponent{Children: []EntityId{child}})
+}
+
+// RemoveParent removes an entity from its parent, making it a root of the hierarchy.
+func (s *Simulation) RemoveParent(child EntityId) {
+	if !s.IsAlive(child) {
+		return
+	}
+
+	s.detachFromParent(child)
+}
+
+// detachFromParent removes the entity from its parent's children and removes its
+// ParentComponent. The parent keeps an empty ChildrenComponent so that it is not moved
+// between archetypes each time its children change.
+func (s *Simulation) detachFromParent(child EntityId) {
+	parent, ok := s.Parent(child)
+	if !ok {
+		return
+	}
+
+	if children, ok := s.Storage.GetComponent(parent, childrenComponentId).(*ChildrenComponent); ok {
+		for index, id := range children.Children {
+			if id == child {
+				children.Children = append(children.Children[:index], children.Children[index+1:]...)
+				break
+			}
+		}
+		s.Storage.MarkChanged(parent, childrenComponentId)
+	}
+	s.RemoveComponent(child, ParentComponent{})
+}
+
+// orphanChildren removes the parent from each child of an entity which is being deleted.
+func (s *Simulation) orphanChildren(id EntityId) {
+	for _, child := range s.Children(id) {
+		s.RemoveComponent(child, ParentComponent{})
+	}
+}
+
+// DeleteEntityRecursive deletes an entity along with all of its descendants.
+func (s *Simulation) DeleteEntityRecursive(id EntityId) {
+	if !s.IsAlive(id) {
+		return
+	}
+
+	for _, child := range s.Children(id) {
+		s.DeleteEntityRecursive(child)
+	}
+	s.DeleteEntity(id)
+}
@@ -0,0 +1,65 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHierarchySetParent(t *testing.T) {
+	sim := NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor())
+	tank := sim.AddEntity(&NameComponent{Name: "tank"})
+	turret := sim.AddEntity(&NameComponent{Name: "turret"})
+	barrel := sim.AddEntity(&NameComponent{Name: "barrel"})
+	hatch := sim.AddEntity(&NameComponent{Name: "hatch"})
+
+	assert.NoError(t, sim.SetParent(turret, tank))
+	assert.NoError(t, sim.SetParent(hatch, tank))
+	assert.NoError(t, sim.SetParent(barrel, turret))
+	assert.Equal(t, []EntityId{turret, hatch}, sim.Children(tank), "children should be kept in order")
+
+	parent, ok := sim.Parent(barrel)
+	assert.True(t, ok)
+	assert.Equal(t, turret, parent)
+	_, ok = sim.Parent(tank)
+	assert.False(t, ok)
+
+	assert.Error(t, sim.SetParent(tank, barrel), "parenting to a descendant should fail")
+	assert.Error(t, sim.SetParent(tank, tank), "parenting to itself should fail")
+
+	// reparenting moves the child to the end of its new parent's children
+	assert.NoError(t, sim.SetParent(barrel, tank))
+	assert.Equal(t, []EntityId{turret, hatch, barrel}, sim.Children(tank))
+	assert.Len(t, sim.Children(turret), 0)
+
+	sim.RemoveParent(hatch)
+	assert.Equal(t, []EntityId{turret, barrel}, sim.Children(tank))
+	_, ok = sim.Parent(hatch)
+	assert.False(t, ok)
+}
+
+func TestHierarchyDelete(t *testing.T) {
+	sim := NewSimpleSimulation()
+	root := sim.AddEntity()
+	child := sim.AddEntity()
+	grandchild := sim.AddEntity()
+	other := sim.AddEntity()
+	assert.NoError(t, sim.SetParent(child, root))
+	assert.NoError(t, sim.SetParent(grandchild, child))
+	assert.NoError(t, sim.SetParent(other, root))
+
+	// deleting an entity detaches it from its parent and orphans its children
+	sim.DeleteEntity(child)
+	assert.Equal(t, []EntityId{other}, sim.Children(root))
+	_, ok := sim.Parent(grandchild)
+	assert.False(t, ok)
+	assert.True(t, sim.IsAlive(grandchild))
+
+	assert.NoError(t, sim.SetParent(grandchild, other))
+	sim.DeleteEntityRecursive(root)
+	assert.False(t, sim.IsAlive(root))
+	assert.False(t, sim.IsAlive(other))
+	assert.False(t, sim.IsAlive(grandchild))
+
+	assert.Error(t, sim.SetParent(grandchild, root), "parenting dead entities should fail")
+}
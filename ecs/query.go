@@ -1,9 +1,13 @@
 package ecs
 
 import (
+	"fmt"
+	"iter"
 	"log"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/nwillc/genfuncs"
@@ -23,62 +27,326 @@ type QueryComponent struct {
 
 // Query abstracts away fetching entities based on their archetype.
 type Query[T any] struct {
-	queryComponents []reflect.Type
-	components      []reflect.Type
-	fields          []*xunsafe.Field
-	entityId        *xunsafe.Field
+	// types holds the component and relation types of the query until they can be resolved
+	// to component ids
+	types      queryTypes
+	components []reflect.Type
+	fields     []*xunsafe.Field
+	entityId   *xunsafe.Field
+	access     SystemAccess
+	// mutable lists the components marked as changed by MarkChanged
+	mutable []reflect.Type
+	// relations are the Relation fields which are filled with the targets of each relation
+	relations []queryRelation
+	// resolved caches the component ids of the query once every type has been registered
+	resolved *atomic.Pointer[resolvedQuery]
+	// caches holds the entities matched within each storage, if the query is cached
+	caches *queryCaches
+	// items holds the items reused by ForEach between executions
+	items *sync.Pool
+}
+
+type queryRelation struct {
+	relation reflect.Type
+	field    *xunsafe.Field
+}
+
+// queryTypes is the component filter of a query, expressed as component types.
+type queryTypes struct {
+	with             []reflect.Type
+	without          []reflect.Type
+	anyOf            [][]reflect.Type
+	added            []reflect.Type
+	changed          []reflect.Type
+	relations        []queryRelationTerm
+	withoutRelations []reflect.Type
+}
+
+// queryRelationTerm is a RelationFilter expressed as a relation type.
+type queryRelationTerm struct {
+	relation reflect.Type
+	target   EntityId
+}
+
+// resolvedQuery is a query with each component type resolved to its component id. Queries
+// are often created by package variables before their components are registered, so types
+// are resolved lazily when the query is first run.
+type resolvedQuery struct {
+	filter     QueryFilter
+	components []ComponentId
+	mutable    []ComponentId
+	// relations holds the id of each Relation field
+	relations []ComponentId
+}
+
+// resolve returns the component ids of the query. Types which are not registered yet are
+// resolved to an id no entity can have, and are retried the next time the query is run.
+func (q *Query[T]) resolve() *resolvedQuery {
+	if resolved := q.resolved.Load(); resolved != nil {
+		return resolved
+	}
+
+	complete := true
+	id := func(componentType reflect.Type) ComponentId {
+		result := componentIdOf(componentType)
+		if result == invalidComponentId {
+			complete = false
+		}
+		return result
+	}
+	ids := func(componentTypes []reflect.Type) []ComponentId {
+		result := make([]ComponentId, len(componentTypes))
+		for index, componentType := range componentTypes {
+			result[index] = id(componentType)
+		}
+		return result
+	}
+
+	result := &resolvedQuery{
+		components: ids(q.components),
+		mutable:    ids(q.mutable),
+		relations:  make([]ComponentId, len(q.relations)),
+	}
+	result.filter.With = ids(q.types.with)
+	result.filter.Without = ids(q.types.without)
+	result.filter.AnyOf = make([][]ComponentId, len(q.types.anyOf))
+	for index, group := range q.types.anyOf {
+		result.filter.AnyOf[index] = ids(group)
+	}
+	result.filter.Added = ids(q.types.added)
+	result.filter.Changed = ids(q.types.changed)
+	result.filter.Relations = make([]RelationFilter, len(q.types.relations))
+	for index, term := range q.types.relations {
+		result.filter.Relations[index] = RelationFilter{Relation: id(term.relation), Target: term.target}
+	}
+	result.filter.WithoutRelations = ids(q.types.withoutRelations)
+	for index, relation := range q.relations {
+		result.relations[index] = id(relation.relation)
+	}
+
+	if complete {
+		q.resolved.Store(result)
+	}
+	return result
+}
+
+// WithRelationTarget returns a copy of the query which only matches entities with a relation
+// of type R to the given target, rather than to any target. If the query is cached the copy
+// has its own caches, which are released separately.
+func WithRelationTarget[R any, T any](query *Query[T], target EntityId) *Query[T] {
+	relation := Relation[R]{}.relationType()
+
+	result := *query
+	result.types.relations = []queryRelationTerm{}
+	for _, term := range query.types.relations {
+		if term.relation != relation {
+			result.types.relations = append(result.types.relations, term)
+		}
+	}
+	result.types.relations = append(result.types.relations, queryRelationTerm{relation: relation, target: target})
+	result.resolved = &atomic.Pointer[resolvedQuery]{}
+	if query.caches != nil {
+		result.caches = &queryCaches{caches: map[EntityStorage]QueryCache{}}
+	}
+	return &result
+}
+
+// Cached returns a copy of the query which registers with each storage it is executed
+// against, so that the storage maintains the entities matching its components as they are
+// added and removed. Executing a cached query costs time proportional to the entities it
+// matches rather than every entity in the storage, at the cost of slightly slower
+// structural changes, so it is best suited to queries run every frame.
+//
+// The query and each storage it has run against reference each other until ReleaseCache is
+// called, so storages which are discarded (or queries which stop being run) should be
+// released to avoid keeping them alive and updating the cache on every structural change.
+func (q *Query[T]) Cached() *Query[T] {
+	result := *q
+	result.caches = &queryCaches{caches: map[EntityStorage]QueryCache{}}
+	return &result
+}
+
+// ReleaseCache unregisters a cached query from the storage, which stops maintaining the
+// query's entities. The cache is created again if the query is run against the storage.
+func (q *Query[T]) ReleaseCache(storage EntityStorage) {
+	if q.caches != nil {
+		q.caches.release(storage)
+	}
+}
+
+// appendAll appends the entities of the storage matching the query, using its cache if it
+// has one. Queries whose types are not registered yet are never cached, as their filter may
+// change once they are.
+func (q *Query[T]) appendAll(result []EntityId, storage EntityStorage, resolved *resolvedQuery, tick uint64) []EntityId {
+	filter := resolved.filter
+	filter.Since = tick
+	if q.caches == nil || q.resolved.Load() != resolved {
+		return storage.AppendAll(result, filter)
+	}
+	return q.caches.cache(storage, filter).AppendAll(result, filter)
+}
+
+// Access returns the component types this query reads and writes. Components are assumed to
+// be written unless their field is tagged with `ecs:"read"`.
+func (q *Query[T]) Access() SystemAccess {
+	return q.access
 }
 
 // Read a single entity from the given storage into a pointer towards the inner query type. This is useful for reading entities into archetypes.
 func (q *Query[T]) Read(storage EntityStorage, id EntityId, target unsafe.Pointer) {
+	q.read(q.resolve(), storage, id, target, false)
+}
+
+// read reads an entity into the target item. If reuse is set, relation fields reuse the
+// targets already held by the item rather than being given a new slice, which is only safe
+// for items which are not kept after being read.
+func (q *Query[T]) read(resolved *resolvedQuery, storage EntityStorage, id EntityId, target unsafe.Pointer, reuse bool) {
 	if q.entityId != nil {
-		q.entityId.SetUint32(target, id)
+		*(*EntityId)(q.entityId.Pointer(target)) = id
 	}
 
-	for index, componentType := range q.components {
-		field := q.fields[index]
-		value := storage.GetComponent(id, componentType)
+	// storages which store entities by row can resolve the entity once and read each field
+	if rows, ok := storage.(rowStorage); ok {
+		row, exists := rows.locateRow(id)
+		for index, componentType := range resolved.components {
+			var value interface{}
+			if exists {
+				value = row.component(componentType)
+			}
+			q.fields[index].SetValue(target, value)
+		}
+	} else {
+		for index, componentType := range resolved.components {
+			field := q.fields[index]
+			value := storage.GetComponent(id, componentType)
+
+			field.SetValue(target, value)
+		}
+	}
 
-		field.SetValue(target, value)
+	for index, relation := range q.relations {
+		if reuse {
+			reuseRelationTargets(relation.field.Pointer(target), storage, id, resolved.relations[index])
+		} else {
+			setRelationTargets(relation.field.Pointer(target), storage.RelationTargets(id, resolved.relations[index]))
+		}
 	}
 }
 
+// Get reads a single entity, returning nil if the entity id is stale.
 func (q *Query[T]) Get(sim *Simulation, id EntityId) *T {
+	if !sim.IsAlive(id) {
+		return nil
+	}
+
 	var result T
 	ptr := &result
 	q.Read(sim.Storage, id, unsafe.Pointer(ptr))
 	return ptr
 }
 
+// MarkChanged marks the entity's components read through fields tagged `ecs:"mut"` as
+// changed, which should be called after modifying them so that `ecs:"changed"` fields of
+// other queries see the change. Reading a component never marks it as changed by itself.
+func (q *Query[T]) MarkChanged(sim *Simulation, id EntityId) {
+	if !sim.IsAlive(id) {
+		return
+	}
+	q.markChanged(q.resolve(), sim.Storage, id)
+}
+
+func (q *Query[T]) markChanged(resolved *resolvedQuery, storage EntityStorage, id EntityId) {
+	for _, componentType := range resolved.mutable {
+		storage.MarkChanged(id, componentType)
+	}
+}
+
+// Execute runs the query against every entity of the simulation. Outside of ExecuteFrame
+// there is no last run to compare against, so fields tagged `ecs:"added"` or `ecs:"changed"`
+// match every entity with the component. The same applies to ExecuteStorage, ForEach, All
+// and ParForEach, each of which has a Frame variant for use within systems.
 func (q *Query[T]) Execute(sim *Simulation) *QueryResultIterator[T] {
 	return q.ExecuteStorage(sim.Storage)
 }
 
+// ExecuteFrame runs the query for the system currently being updated, with added and changed
+// components only matching if they are newer than the system's last run.
+func (q *Query[T]) ExecuteFrame(frame *SimulationFrame) *QueryResultIterator[T] {
+	return q.executeSince(frame.Sim.Storage, frame.LastRun)
+}
+
 func (q *Query[T]) ExecuteStorage(storage EntityStorage) *QueryResultIterator[T] {
+	return q.executeSince(storage, 0)
+}
+
+func (q *Query[T]) executeSince(storage EntityStorage, tick uint64) *QueryResultIterator[T] {
+	resolved := q.resolve()
 	res := &QueryResultIterator[T]{
-		ids:     storage.FindAll(q.queryComponents),
-		index:   0,
-		storage: storage,
-		query:   q,
+		ids:      q.appendAll([]EntityId{}, storage, resolved, tick),
+		index:    0,
+		storage:  storage,
+		query:    q,
+		resolved: resolved,
 	}
 	res.ptr = unsafe.Pointer(&res.Item)
 	return res
 }
 
+// NewQuery creates a query for the given struct type. Each exported pointer field is read
+// from the matched entities, and by default entities must have every field's component.
+// Fields may be tagged to change this:
+//
+//	`ecs:"optional"`     the component is read if present, but not required
+//	`ecs:"without"`      entities must not have the component, the field is left nil
+//	`ecs:"anyof=group"`  entities must have at least one of the components tagged with the
+//	                     same group, each is read if present
+//	`ecs:"read"`         the component is only read, allowing systems to run concurrently
+//	`ecs:"mut"`          the component is marked as changed by MarkChanged
+//	`ecs:"added"`        entities must have had the component added since the system last ran,
+//	                     outside of ExecuteFrame every entity with the component matches
+//	`ecs:"changed"`      entities must have had the component changed since the system last
+//	                     ran, outside of ExecuteFrame every entity with the component matches
+//	`ecs:"-"`            the field is ignored
+//
+// Fields of type Relation[R] match entities with a relation of type R to any target, and
+// are filled with the relation's targets. They may also be tagged optional or without, and
+// WithRelationTarget narrows the query to a specific target.
+//
+// Added and changed components are only filtered when the query is run with ExecuteFrame,
+// otherwise every entity with the component matches. Since they require the component,
+// they may not be combined with optional or anyof fields.
+//
+// Component fields point at the stored components, which storages may move as entities are
+// deleted or have components added or removed (see EntityStorage), so items should not be
+// kept across those changes.
+//
+// NewQuery panics if the query type is invalid, see TryNewQuery.
 func NewQuery[T any]() *Query[T] {
+	query, err := TryNewQuery[T]()
+	if err != nil {
+		log.Panicf("invalid query: %v", err)
+	}
+	return query
+}
+
+// TryNewQuery creates a query for the given struct type (see NewQuery), returning an error
+// wrapping ErrInvalidComponentType if the type is not a struct or any of its fields are
+// invalid.
+func TryNewQuery[T any]() (*Query[T], error) {
 	var query T
 	queryType := reflect.TypeOf(query)
-	if queryType.Kind() != reflect.Struct {
-		log.Panicf("invalid query type: %v", queryType)
-		return nil
+	if queryType == nil || queryType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: query type %v must be a struct", ErrInvalidComponentType, queryType)
 	}
 
 	result := &Query[T]{
-		components:      []reflect.Type{},
-		queryComponents: []reflect.Type{},
-		fields:          []*xunsafe.Field{},
-		entityId:        nil,
+		components: []reflect.Type{},
+		fields:     []*xunsafe.Field{},
+		entityId:   nil,
+		resolved:   &atomic.Pointer[resolvedQuery]{},
+		items:      &sync.Pool{New: func() interface{} { return new(T) }},
 	}
+	anyOfGroups := map[string]int{}
 
 	for fieldIdx := 0; fieldIdx < queryType.NumField(); fieldIdx++ {
 		field := queryType.Field(fieldIdx)
@@ -88,6 +356,12 @@ func NewQuery[T any]() *Query[T] {
 
 		optional := false
 		skipped := false
+		readOnly := false
+		without := false
+		mutable := false
+		added := false
+		changed := false
+		anyOf := ""
 
 		tags := strings.Split(field.Tag.Get("ecs"), ",")
 		for _, tag := range tags {
@@ -96,6 +370,18 @@ func NewQuery[T any]() *Query[T] {
 				break
 			} else if tag == "optional" {
 				optional = true
+			} else if tag == "read" {
+				readOnly = true
+			} else if tag == "without" {
+				without = true
+			} else if tag == "mut" {
+				mutable = true
+			} else if tag == "added" {
+				added = true
+			} else if tag == "changed" {
+				changed = true
+			} else if strings.HasPrefix(tag, "anyof=") {
+				anyOf = strings.TrimPrefix(tag, "anyof=")
 			}
 		}
 
@@ -105,39 +391,92 @@ func NewQuery[T any]() *Query[T] {
 
 		if field.Type == entityIdType {
 			if result.entityId != nil {
-				log.Panicf("multiple entity id fields in query %v", query)
-				return nil
+				return nil, fmt.Errorf("%w: query %v has multiple entity id fields", ErrInvalidComponentType, queryType)
 			}
 
 			result.entityId = xunsafe.FieldByIndex(queryType, fieldIdx)
 			continue
 		}
 
-		if !optional {
-			result.queryComponents = append(result.queryComponents, field.Type)
+		if field.Type.Implements(relationFieldType) {
+			relation := reflect.Zero(field.Type).Interface().(relationField).relationType()
+			if without {
+				result.types.withoutRelations = append(result.types.withoutRelations, relation)
+				continue
+			} else if !optional {
+				result.types.relations = append(result.types.relations, queryRelationTerm{relation: relation})
+			}
+
+			result.relations = append(result.relations, queryRelation{
+				relation: relation,
+				field:    xunsafe.FieldByIndex(queryType, fieldIdx),
+			})
+			continue
+		}
+
+		if field.Type.Kind() != reflect.Pointer || field.Type.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%w: field %v of query %v must be a pointer to a component struct", ErrInvalidComponentType, field.Name, queryType)
+		}
+
+		if without {
+			result.types.without = append(result.types.without, field.Type)
+			continue
+		}
+
+		if (added || changed) && (optional || anyOf != "") {
+			return nil, fmt.Errorf("%w: field %v of query %v can not be added or changed while optional or anyof", ErrInvalidComponentType, field.Name, queryType)
+		}
+
+		if anyOf != "" {
+			group, exists := anyOfGroups[anyOf]
+			if !exists {
+				group = len(result.types.anyOf)
+				anyOfGroups[anyOf] = group
+				result.types.anyOf = append(result.types.anyOf, []reflect.Type{})
+			}
+			result.types.anyOf[group] = append(result.types.anyOf[group], field.Type)
+		} else if !optional {
+			result.types.with = append(result.types.with, field.Type)
+		}
+
+		if added {
+			result.types.added = append(result.types.added, field.Type)
+		}
+		if changed {
+			result.types.changed = append(result.types.changed, field.Type)
+		}
+		if mutable {
+			result.mutable = append(result.mutable, field.Type)
+		}
+
+		if readOnly && !mutable {
+			result.access.Read = append(result.access.Read, field.Type)
+		} else {
+			result.access.Write = append(result.access.Write, field.Type)
 		}
 
 		result.components = append(result.components, field.Type)
 		result.fields = append(result.fields, xunsafe.FieldByIndex(queryType, fieldIdx))
 	}
 
-	return result
+	return result, nil
 }
 
 type QueryResultIterator[T any] struct {
 	Item T
 
-	storage EntityStorage
-	query   *Query[T]
-	ptr     unsafe.Pointer
-	ids     []EntityId
-	index   uint32
+	storage  EntityStorage
+	query    *Query[T]
+	resolved *resolvedQuery
+	ptr      unsafe.Pointer
+	ids      []EntityId
+	index    uint32
 }
 
 // Sorts the underlying entity index for this query, ensuring entities are iterated in ascending order by id
 func (q *QueryResultIterator[T]) Sort() {
-	container.GSlice[uint32](q.ids).SortBy(func(a EntityId, b EntityId) bool {
-		return genfuncs.OrderedLessThan(a)(b)
+	container.GSlice[EntityId](q.ids).SortBy(func(a EntityId, b EntityId) bool {
+		return genfuncs.OrderedLess(a, b)
 	})
 }
 
@@ -148,7 +487,7 @@ func (q *QueryResultIterator[T]) Get() *T {
 
 	var result T
 	ptr := &result
-	q.query.Read(q.storage, q.ids[q.index], unsafe.Pointer(ptr))
+	q.query.read(q.resolved, q.storage, q.ids[q.index], unsafe.Pointer(ptr), false)
 	return ptr
 }
 
@@ -158,15 +497,46 @@ func (q *QueryResultIterator[T]) Next() bool {
 	}
 
 	id := q.ids[q.index]
-	q.query.Read(q.storage, id, q.ptr)
+	q.query.read(q.resolved, q.storage, id, q.ptr, false)
 	q.index += 1
 	return true
 }
 
+// All iterates the remaining entities of the iterator, reading each into Item.
+func (q *QueryResultIterator[T]) All() iter.Seq2[EntityId, *T] {
+	return func(yield func(EntityId, *T) bool) {
+		for q.Next() {
+			if !yield(q.ids[q.index-1], &q.Item) {
+				return
+			}
+		}
+	}
+}
+
+// Items iterates the remaining items of the iterator, see All.
+func (q *QueryResultIterator[T]) Items() iter.Seq[*T] {
+	return func(yield func(*T) bool) {
+		for q.Next() {
+			if !yield(&q.Item) {
+				return
+			}
+		}
+	}
+}
+
+// MarkChanged marks the components of the current item read through fields tagged
+// `ecs:"mut"` as changed, see Query.MarkChanged.
+func (q *QueryResultIterator[T]) MarkChanged() {
+	if q.index == 0 {
+		return
+	}
+	q.query.markChanged(q.resolved, q.storage, q.ids[q.index-1])
+}
+
 func (q *QueryResultIterator[T]) ToList() []T {
 	result := make([]T, len(q.ids))
 	for idx := range result {
-		q.query.Read(q.storage, q.ids[idx], unsafe.Pointer(&result[idx]))
+		q.query.read(q.resolved, q.storage, q.ids[idx], unsafe.Pointer(&result[idx]), false)
 	}
 
 	return result
@@ -178,6 +548,6 @@ func (q *QueryResultIterator[T]) First() (T, bool) {
 		return result, false
 	}
 	id := q.ids[0]
-	q.query.Read(q.storage, id, unsafe.Pointer(&result))
+	q.query.read(q.resolved, q.storage, id, unsafe.Pointer(&result), false)
 	return result, true
 }
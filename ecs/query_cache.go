@@ -0,0 +1,135 @@
+package ecs
+
+import (
+	"sync"
+)
+
+// QueryCache holds the entities matching the components of a filter, which the storage that
+// created it keeps up to date as entities gain and lose components.
+type QueryCache interface {
+	// FindAll returns the cached entities which also match the change ticks and relations of
+	// the filter. The filter's components must match those the cache was created with.
+	FindAll(QueryFilter) []EntityId
+	// AppendAll appends the entities FindAll would return to the given slice.
+	AppendAll([]EntityId, QueryFilter) []EntityId
+}
+
+// entitySetCache caches the entities matching a filter within a sparse set, used by storages
+// which do not group entities by their components.
+type entitySetCache struct {
+	filter   QueryFilter
+	entities *sparseSet
+	// matcher prepares a function which checks the change ticks and relations of a filter
+	// against a cached entity
+	matcher func(QueryFilter) func(EntityId) bool
+}
+
+func (c *entitySetCache) FindAll(filter QueryFilter) []EntityId {
+	return c.AppendAll(make([]EntityId, 0, c.entities.len()), filter)
+}
+
+func (c *entitySetCache) AppendAll(result []EntityId, filter QueryFilter) []EntityId {
+	if !filter.tracksChanges() && !filter.tracksRelations() {
+		return append(result, c.entities.dense...)
+	}
+
+	matches := c.matcher(filter)
+	for _, id := range c.entities.dense {
+		if matches(id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// entityCacheIndex is embedded by storages which maintain entitySetCaches, which must call
+// updateCaches whenever an entity gains or loses a component and uncache when it is deleted.
+type entityCacheIndex struct {
+	// lock guards the list of caches, which may be registered by queries executing concurrently
+	lock   sync.RWMutex
+	caches []*entitySetCache
+}
+
+// cacheQuery registers a new cache, filling it with the entities of the storage which match
+// using the given function.
+func (i *entityCacheIndex) cacheQuery(filter QueryFilter, findAll func(QueryFilter) []EntityId, matcher func(QueryFilter) func(EntityId) bool) QueryCache {
+	// only the components of the filter are cached
+	components := QueryFilter{With: filter.With, Without: filter.Without, AnyOf: filter.AnyOf}
+	cache := &entitySetCache{filter: components, entities: newSparseSet(), matcher: matcher}
+	for _, id := range findAll(components) {
+		cache.entities.insert(id, nil, 0)
+	}
+
+	i.lock.Lock()
+	i.caches = append(i.caches, cache)
+	i.lock.Unlock()
+	return cache
+}
+
+// release unregisters the cache of the query within the storage, if it has one.
+func (c *queryCaches) release(storage EntityStorage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cache, exists := c.caches[storage]; exists {
+		storage.ReleaseQuery(cache)
+		delete(c.caches, storage)
+	}
+}
+
+// releaseQuery removes a cache, so that it is no longer updated.
+func (i *entityCacheIndex) releaseQuery(cache QueryCache) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for index, existing := range i.caches {
+		if existing == cache {
+			i.caches = append(i.caches[:index], i.caches[index+1:]...)
+			return
+		}
+	}
+}
+
+// updateCaches adds or removes the entity from each cache, given a function which reports
+// whether the entity has a component.
+func (i *entityCacheIndex) updateCaches(id EntityId, has func(ComponentId) bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	for _, cache := range i.caches {
+		if !cache.filter.Matches(has) {
+			cache.entities.remove(id)
+		} else if !cache.entities.contains(id) {
+			cache.entities.insert(id, nil, 0)
+		}
+	}
+}
+
+// uncache removes a deleted entity from every cache.
+func (i *entityCacheIndex) uncache(id EntityId) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	for _, cache := range i.caches {
+		cache.entities.remove(id)
+	}
+}
+
+// queryCaches holds the cache of a query for each storage it has been executed against.
+type queryCaches struct {
+	lock   sync.Mutex
+	caches map[EntityStorage]QueryCache
+}
+
+// cache returns the cache of the query within the storage, registering it the first time.
+func (c *queryCaches) cache(storage EntityStorage, filter QueryFilter) QueryCache {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cache, exists := c.caches[storage]
+	if !exists {
+		cache = storage.CacheQuery(filter)
+		c.caches[storage] = cache
+	}
+	return cache
+}
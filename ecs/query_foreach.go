@@ -0,0 +1,109 @@
+package ecs
+
+import (
+	"iter"
+	"sync"
+	"unsafe"
+)
+
+// entityIdBuffers holds the id slices reused by ForEach between executions.
+var entityIdBuffers = sync.Pool{
+	New: func() interface{} {
+		return &[]EntityId{}
+	},
+}
+
+// ForEach calls fn for every entity matched by the query. Unlike Execute it reuses the
+// buffers it needs between calls, so iterating a query every frame does not allocate once
+// those buffers have grown to fit the results. The item passed to fn is reused for each
+// entity (including the Targets of its Relation fields), so it must not be retained after
+// fn returns.
+//
+// Entities are matched before fn is first called, so entities spawned by fn are not
+// visited. However entities deleted by fn are still visited with nil components, and
+// structural changes may move the components of other entities (see EntityStorage), so
+// structural changes should be recorded with a CommandBuffer instead.
+func (q *Query[T]) ForEach(sim *Simulation, fn func(*T)) {
+	q.eachSince(sim.Storage, 0, func(id EntityId, item *T) bool {
+		fn(item)
+		return true
+	})
+}
+
+// ForEachFrame calls fn for every entity matched by the query for the system currently being
+// updated, see ExecuteFrame and ForEach.
+func (q *Query[T]) ForEachFrame(frame *SimulationFrame, fn func(*T)) {
+	q.eachSince(frame.Sim.Storage, frame.LastRun, func(id EntityId, item *T) bool {
+		fn(item)
+		return true
+	})
+}
+
+// ForEachStorage calls fn for every entity in the storage matched by the query, see ForEach.
+func (q *Query[T]) ForEachStorage(storage EntityStorage, fn func(*T)) {
+	q.eachSince(storage, 0, func(id EntityId, item *T) bool {
+		fn(item)
+		return true
+	})
+}
+
+// All iterates the id and item of every entity matched by the query, with the same buffer
+// reuse and rules as ForEach:
+//
+//	for id, item := range query.All(sim) {
+//		...
+//	}
+func (q *Query[T]) All(sim *Simulation) iter.Seq2[EntityId, *T] {
+	return q.AllStorage(sim.Storage)
+}
+
+// AllFrame iterates every entity matched by the query for the system currently being
+// updated, see ExecuteFrame and All.
+func (q *Query[T]) AllFrame(frame *SimulationFrame) iter.Seq2[EntityId, *T] {
+	return func(yield func(EntityId, *T) bool) {
+		q.eachSince(frame.Sim.Storage, frame.LastRun, yield)
+	}
+}
+
+// AllStorage iterates every entity in the storage matched by the query, see All.
+func (q *Query[T]) AllStorage(storage EntityStorage) iter.Seq2[EntityId, *T] {
+	return func(yield func(EntityId, *T) bool) {
+		q.eachSince(storage, 0, yield)
+	}
+}
+
+// Items iterates the item of every entity matched by the query, see All.
+func (q *Query[T]) Items(sim *Simulation) iter.Seq[*T] {
+	return func(yield func(*T) bool) {
+		q.eachSince(sim.Storage, 0, func(id EntityId, item *T) bool {
+			return yield(item)
+		})
+	}
+}
+
+// eachSince reads every matched entity into a pooled item and passes it to fn, stopping
+// early if fn returns false.
+func (q *Query[T]) eachSince(storage EntityStorage, tick uint64, fn func(EntityId, *T) bool) {
+	resolved := q.resolve()
+	buffer := entityIdBuffers.Get().(*[]EntityId)
+	ids := q.appendAll((*buffer)[:0], storage, resolved, tick)
+
+	item := q.items.Get().(*T)
+	ptr := unsafe.Pointer(item)
+	for _, id := range ids {
+		q.read(resolved, storage, id, ptr, true)
+		if !fn(id, item) {
+			break
+		}
+	}
+
+	// clear the components of the item so that pooled items do not keep them alive, while
+	// relation targets hold no pointers and are kept to be reused
+	for _, field := range q.fields {
+		field.SetValue(ptr, nil)
+	}
+	q.items.Put(item)
+
+	*buffer = ids
+	entityIdBuffers.Put(buffer)
+}
@@ -0,0 +1,101 @@
+package ecs
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// DefaultMinBatchSize is the minimum number of entities each worker of ParForEach is given,
+// below which the overhead of starting a goroutine outweighs the work it does.
+const DefaultMinBatchSize = 1024
+
+// ParallelOptions configures how ParForEachWith splits entities between workers.
+type ParallelOptions struct {
+	// Workers is the maximum number of goroutines entities are split between, defaulting to
+	// GOMAXPROCS.
+	Workers int
+	// MinBatchSize is the minimum number of entities given to each worker, defaulting to
+	// DefaultMinBatchSize.
+	MinBatchSize int
+}
+
+// ParForEach calls fn for every entity matched by the query, splitting them between
+// goroutines with the default ParallelOptions. See ParForEachWith.
+func (q *Query[T]) ParForEach(sim *Simulation, fn func(*T)) {
+	q.ParForEachWith(sim, ParallelOptions{}, fn)
+}
+
+// ParForEachFrame calls fn for every entity matched by the query for the system currently
+// being updated, see ExecuteFrame and ParForEachWith.
+func (q *Query[T]) ParForEachFrame(frame *SimulationFrame, fn func(*T)) {
+	q.ParForEachFrameWith(frame, ParallelOptions{}, fn)
+}
+
+// ParForEachFrameWith is ParForEachFrame with the given options, see ParForEachWith.
+func (q *Query[T]) ParForEachFrameWith(frame *SimulationFrame, options ParallelOptions, fn func(*T)) {
+	q.parForEachSince(frame.Sim.Storage, frame.LastRun, options, fn)
+}
+
+// ParForEachWith calls fn for every entity matched by the query, splitting them into batches
+// which are run on separate goroutines, and returns once every entity has been visited. The
+// order entities are visited in is undefined, and the item passed to fn is reused by each
+// worker so it must not be retained after fn returns.
+//
+// While entities are being visited fn may read and modify the components of the entity it
+// is given (including marking them as changed), and read the components of other entities
+// which are not being modified. Structural changes such as adding or deleting entities,
+// adding or removing components, and adding or removing relations are not safe, and should
+// be recorded with the frame's CommandBuffer instead, which is safe to use from every worker.
+func (q *Query[T]) ParForEachWith(sim *Simulation, options ParallelOptions, fn func(*T)) {
+	q.parForEachSince(sim.Storage, 0, options, fn)
+}
+
+func (q *Query[T]) parForEachSince(storage EntityStorage, tick uint64, options ParallelOptions, fn func(*T)) {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	minBatchSize := options.MinBatchSize
+	if minBatchSize <= 0 {
+		minBatchSize = DefaultMinBatchSize
+	}
+
+	resolved := q.resolve()
+	ids := q.appendAll([]EntityId{}, storage, resolved, tick)
+
+	batchSize := (len(ids) + workers - 1) / workers
+	if batchSize < minBatchSize {
+		batchSize = minBatchSize
+	}
+
+	visit := func(ids []EntityId) {
+		var item T
+		ptr := unsafe.Pointer(&item)
+		for _, id := range ids {
+			q.read(resolved, storage, id, ptr, true)
+			fn(&item)
+		}
+	}
+
+	// small queries are visited on the calling goroutine
+	if len(ids) <= batchSize {
+		visit(ids)
+		return
+	}
+
+	var wait sync.WaitGroup
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		wait.Add(1)
+		go func(ids []EntityId) {
+			defer wait.Done()
+			visit(ids)
+		}(ids[start:end])
+	}
+	wait.Wait()
+}
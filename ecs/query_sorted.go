@@ -0,0 +1,169 @@
+package ecs
+
+import (
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// maxInsertionSortSwaps is the number of swaps per item insertion sort may make before
+// sortedItems fall back to sort.Stable, bounding the work to linear time when the items are
+// nearly sorted and O(n log n) otherwise.
+const maxInsertionSortSwaps = 8
+
+// sortedItems sorts the ids of a query result along with the items read from them.
+type sortedItems[T any] struct {
+	ids   []EntityId
+	items []T
+	less  func(a, b *T) bool
+}
+
+func (s *sortedItems[T]) Len() int {
+	return len(s.ids)
+}
+
+func (s *sortedItems[T]) Less(i, j int) bool {
+	return s.less(&s.items[i], &s.items[j])
+}
+
+func (s *sortedItems[T]) Swap(i, j int) {
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+}
+
+// sort stably sorts the items, using insertion sort while only a few are out of order.
+func (s *sortedItems[T]) sort() {
+	budget := len(s.ids) * maxInsertionSortSwaps
+	for index := 1; index < len(s.ids); index++ {
+		for moved := index; moved > 0 && s.Less(moved, moved-1); moved-- {
+			if budget == 0 {
+				// insertion sort never reorders equal items, so the result is still stable
+				sort.Stable(s)
+				return
+			}
+			s.Swap(moved, moved-1)
+			budget--
+		}
+	}
+}
+
+// readItems reads the given entities into items.
+func (q *Query[T]) readItems(resolved *resolvedQuery, storage EntityStorage, ids []EntityId, items []T) {
+	for index, id := range ids {
+		q.read(resolved, storage, id, unsafe.Pointer(&items[index]), false)
+	}
+}
+
+// SortBy sorts the underlying entity index for this query so that entities are iterated in
+// the order given by less, which reports whether a should come before b. Entities which
+// compare equal keep their existing order.
+func (q *QueryResultIterator[T]) SortBy(less func(a, b *T) bool) {
+	items := &sortedItems[T]{ids: q.ids, items: make([]T, len(q.ids)), less: less}
+	q.query.readItems(q.resolved, q.storage, q.ids, items.items)
+	items.sort()
+}
+
+// SortedQuery is a query whose results are kept ordered between executions. Each execution
+// starts from the previous order, so when only a few entities change position (or are
+// added) they are moved into place in linear time rather than sorting every result again.
+type SortedQuery[T any] struct {
+	query *Query[T]
+	less  func(a, b *T) bool
+
+	lock    sync.Mutex
+	storage EntityStorage
+	// order holds the matched entities in sorted order as of the last execution
+	order []EntityId
+	// members maps each entity in order to the generation of the execution that last
+	// matched it
+	members    map[EntityId]uint32
+	generation uint32
+	matched    []EntityId
+	items      []T
+}
+
+// Sorted returns a query which iterates entities in the order given by less, which reports
+// whether a should come before b. Entities which compare equal keep the order they where
+// first matched in. The returned query keeps its order between executions, so it should be
+// created once and reused rather than created every frame.
+func (q *Query[T]) Sorted(less func(a, b *T) bool) *SortedQuery[T] {
+	return &SortedQuery[T]{
+		query:   q,
+		less:    less,
+		order:   []EntityId{},
+		members: map[EntityId]uint32{},
+	}
+}
+
+// Access returns the component types the underlying query reads and writes.
+func (s *SortedQuery[T]) Access() SystemAccess {
+	return s.query.Access()
+}
+
+func (s *SortedQuery[T]) Execute(sim *Simulation) *QueryResultIterator[T] {
+	return s.ExecuteStorage(sim.Storage)
+}
+
+// ExecuteFrame runs the query for the system currently being updated, see Query.ExecuteFrame.
+func (s *SortedQuery[T]) ExecuteFrame(frame *SimulationFrame) *QueryResultIterator[T] {
+	return s.executeSince(frame.Sim.Storage, frame.LastRun)
+}
+
+func (s *SortedQuery[T]) ExecuteStorage(storage EntityStorage) *QueryResultIterator[T] {
+	return s.executeSince(storage, 0)
+}
+
+func (s *SortedQuery[T]) executeSince(storage EntityStorage, tick uint64) *QueryResultIterator[T] {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the order is only meaningful within the storage it was built from
+	if storage != s.storage {
+		s.storage = storage
+		s.order = s.order[:0]
+		s.members = map[EntityId]uint32{}
+	}
+
+	resolved := s.query.resolve()
+	s.matched = s.query.appendAll(s.matched[:0], storage, resolved, tick)
+	s.generation++
+
+	// keep the previous order of entities which still match, followed by any new entities
+	previous := len(s.order)
+	for _, id := range s.matched {
+		if _, exists := s.members[id]; !exists {
+			s.order = append(s.order, id)
+		}
+		s.members[id] = s.generation
+	}
+	kept := 0
+	for index, id := range s.order {
+		if index < previous && s.members[id] != s.generation {
+			delete(s.members, id)
+			continue
+		}
+		s.order[kept] = id
+		kept++
+	}
+	s.order = s.order[:kept]
+
+	if cap(s.items) < len(s.order) {
+		s.items = make([]T, len(s.order))
+	}
+	items := &sortedItems[T]{ids: s.order, items: s.items[:len(s.order)], less: s.less}
+	s.query.readItems(resolved, storage, items.ids, items.items)
+	items.sort()
+
+	// clear the items so that they do not keep components alive
+	clear(items.items)
+
+	res := &QueryResultIterator[T]{
+		ids:      append(make([]EntityId, 0, len(s.order)), s.order...),
+		index:    0,
+		storage:  storage,
+		query:    s.query,
+		resolved: resolved,
+	}
+	res.ptr = unsafe.Pointer(&res.Item)
+	return res
+}
@@ -1,6 +1,7 @@
 package ecs
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,6 +19,12 @@ type componentC struct {
 	C bool
 }
 
+var (
+	componentAId = RegisterComponent[componentA]("test.A")
+	componentBId = RegisterComponent[componentB]("test.B")
+	componentCId = RegisterComponent[componentC]("test.C")
+)
+
 func TestQueryToList(t *testing.T) {
 	sim := NewSimpleSimulation()
 	for n := 0; n < 1000; n++ {
@@ -35,7 +42,8 @@ func TestQueryToList(t *testing.T) {
 	result := iter.ToList()
 	assert.Len(t, result, 1000)
 	for _, item := range result {
-		assert.Equal(t, item.Id, EntityId(item.A.A))
+		// the first entity index is reserved, so ids start at one
+		assert.Equal(t, item.Id, EntityId(item.A.A)+1)
 	}
 }
 func TestQueryFirst(t *testing.T) {
@@ -52,6 +60,8 @@ func TestQueryFirst(t *testing.T) {
 		A  *componentA
 	}]()
 	iter := query.Execute(sim)
+	// storages do not guarantee iteration order
+	iter.Sort()
 
 	item, ok := iter.First()
 	assert.True(t, ok)
@@ -82,3 +92,408 @@ func TestQueryOptionalField(t *testing.T) {
 	iterAll := queryAll.Execute(sim)
 	assert.Len(t, iterAll.ToList(), 1000)
 }
+
+func TestQueryFilterFields(t *testing.T) {
+	sim := NewSimpleSimulation()
+	for n := 0; n < 100; n++ {
+		switch n % 4 {
+		case 0:
+			sim.AddEntity(&componentA{A: float64(n)})
+		case 1:
+			sim.AddEntity(&componentA{A: float64(n)}, &componentB{B: int64(n)})
+		case 2:
+			sim.AddEntity(&componentA{A: float64(n)}, &componentC{C: true})
+		default:
+			sim.AddEntity(&componentB{B: int64(n)})
+		}
+	}
+
+	queryWithout := NewQuery[struct {
+		A *componentA
+		B *componentB `ecs:"without"`
+	}]()
+	withoutList := queryWithout.Execute(sim).ToList()
+	assert.Len(t, withoutList, 50)
+	for _, item := range withoutList {
+		assert.NotNil(t, item.A)
+		assert.Nil(t, item.B, "without fields should be left nil")
+	}
+
+	queryAnyOf := NewQuery[struct {
+		A *componentA
+		B *componentB `ecs:"anyof=extra"`
+		C *componentC `ecs:"anyof=extra"`
+	}]()
+	anyOfList := queryAnyOf.Execute(sim).ToList()
+	assert.Len(t, anyOfList, 50)
+	for _, item := range anyOfList {
+		assert.True(t, (item.B == nil) != (item.C == nil), "exactly one any of field should be set")
+	}
+
+	queryCombined := NewQuery[struct {
+		B *componentB `ecs:"anyof=first"`
+		C *componentC `ecs:"anyof=second,read"`
+		A *componentA `ecs:"optional"`
+	}]()
+	assert.Len(t, queryCombined.Execute(sim).ToList(), 0, "separate any of groups must each match")
+}
+
+type forEachQuery struct {
+	Id EntityId
+	A  *componentA
+	B  *componentB `ecs:"optional"`
+}
+
+func TestQueryForEach(t *testing.T) {
+	sim := NewSimpleSimulation()
+	for n := 0; n < 100; n++ {
+		if n%2 == 0 {
+			sim.AddEntity(&componentA{A: float64(n)}, &componentB{B: int64(n)})
+		} else {
+			sim.AddEntity(&componentB{B: int64(n)})
+		}
+	}
+
+	query := NewQuery[forEachQuery]()
+	visited := []EntityId{}
+	query.ForEach(sim, func(item *forEachQuery) {
+		assert.Equal(t, float64(item.B.B), item.A.A)
+		visited = append(visited, item.Id)
+
+		// entities are matched up front, so deleting the visited entity is allowed
+		sim.DeleteEntity(item.Id)
+	})
+	assert.Len(t, visited, 50)
+	assert.Len(t, query.Execute(sim).ToList(), 0)
+
+	id := sim.AddEntity(&componentA{A: 1})
+	query.ForEach(sim, func(item *forEachQuery) {
+		assert.Equal(t, id, item.Id)
+		assert.Nil(t, item.B, "reused items should not keep the fields of previous entities")
+	})
+}
+
+func newForEachSimulation(storage EntityStorage, count int) *Simulation {
+	sim := NewSimulation(storage, NewSequentialSystemExecutor())
+	for n := 0; n < count; n++ {
+		switch n % 3 {
+		case 0:
+			sim.AddEntity(&componentA{A: float64(n)})
+		case 1:
+			sim.AddEntity(&componentA{A: float64(n)}, &componentB{B: int64(n)})
+		default:
+			sim.AddEntity(&componentB{B: int64(n)})
+		}
+	}
+	return sim
+}
+
+func TestQueryAll(t *testing.T) {
+	sim := newForEachSimulation(NewEntitySimpleStorage(), 30)
+	query := NewQuery[forEachQuery]()
+
+	ids := []EntityId{}
+	for id, item := range query.All(sim) {
+		assert.Equal(t, id, item.Id)
+		assert.NotNil(t, item.A)
+		ids = append(ids, id)
+	}
+	assert.Len(t, ids, 20)
+
+	count := 0
+	for item := range query.Items(sim) {
+		assert.NotNil(t, item.A)
+		count++
+		if count == 5 {
+			break
+		}
+	}
+	assert.Equal(t, 5, count, "iteration should stop early")
+
+	// iterators continue from wherever Next left off
+	result := query.Execute(sim)
+	result.Next()
+	remaining := []EntityId{}
+	for id, item := range result.All() {
+		assert.Same(t, &result.Item, item)
+		remaining = append(remaining, id)
+	}
+	assert.Len(t, remaining, 19)
+	assert.False(t, result.Next())
+
+	result = query.Execute(sim)
+	for range result.Items() {
+		break
+	}
+	assert.Len(t, result.ToList(), 20)
+	assert.True(t, result.Next(), "stopping early should leave the rest of the entities")
+}
+
+// forEachAllocs returns the allocations made by each ForEach once its buffers have grown.
+func forEachAllocs(sim *Simulation, query *Query[forEachQuery]) float64 {
+	sum := 0.0
+	fn := func(item *forEachQuery) {
+		sum += item.A.A
+	}
+	query.ForEach(sim, fn)
+	return testing.AllocsPerRun(100, func() {
+		query.ForEach(sim, fn)
+	})
+}
+
+type forEachRelationQuery struct {
+	A     *componentA
+	Likes Relation[likesRelation]
+}
+
+// newForEachRelationSimulation creates a simulation where every entity with componentA likes
+// the entities either side of it.
+func newForEachRelationSimulation(storage EntityStorage, count int) *Simulation {
+	sim := newForEachSimulation(storage, count)
+	ids := []EntityId{}
+	for id := range NewQuery[forEachQuery]().All(sim) {
+		ids = append(ids, id)
+	}
+	for index, id := range ids {
+		AddRelation[likesRelation](sim, id, ids[(index+1)%len(ids)])
+		AddRelation[likesRelation](sim, id, ids[(index+len(ids)-1)%len(ids)])
+	}
+	return sim
+}
+
+// forEachRelationAllocs returns the allocations made by each ForEach of a query with a
+// relation field once its buffers have grown.
+func forEachRelationAllocs(sim *Simulation, query *Query[forEachRelationQuery]) float64 {
+	targets := 0
+	fn := func(item *forEachRelationQuery) {
+		targets += len(item.Likes.Targets)
+	}
+	query.ForEach(sim, fn)
+	return testing.AllocsPerRun(100, func() {
+		query.ForEach(sim, fn)
+	})
+}
+
+var forEachStorages = map[string]func() EntityStorage{
+	"Simple":    func() EntityStorage { return NewEntitySimpleStorage() },
+	"Archetype": func() EntityStorage { return NewEntityArchetypeStorage() },
+	"SparseSet": func() EntityStorage { return NewEntitySparseSetStorage() },
+}
+
+func TestQueryForEachDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not reliable with the race detector")
+	}
+
+	for name, storage := range forEachStorages {
+		sim := newForEachSimulation(storage(), 1000)
+		query := NewQuery[forEachQuery]()
+		assert.Zero(t, forEachAllocs(sim, query), "%s storage should not allocate", name)
+		assert.Zero(t, forEachAllocs(sim, query.Cached()), "%s storage should not allocate when cached", name)
+
+		related := newForEachRelationSimulation(storage(), 1000)
+		assert.Zero(t, forEachRelationAllocs(related, NewQuery[forEachRelationQuery]()), "%s storage should not allocate relation targets", name)
+	}
+}
+
+func TestQueryForEachRelationTargets(t *testing.T) {
+	sim := newForEachRelationSimulation(NewEntitySimpleStorage(), 30)
+	query := NewQuery[forEachRelationQuery]()
+
+	// targets are reused by ForEach, while iterators copy them for each entity
+	expected := map[*componentA][]EntityId{}
+	for _, item := range query.Execute(sim).ToList() {
+		expected[item.A] = item.Likes.Targets
+	}
+	assert.Len(t, expected, 20)
+	query.ForEach(sim, func(item *forEachRelationQuery) {
+		assert.Equal(t, expected[item.A], item.Likes.Targets)
+	})
+}
+
+func benchmarkQueryForEach(b *testing.B, storage EntityStorage, query *Query[forEachQuery]) {
+	sim := newForEachSimulation(storage, 10000)
+	if allocs := forEachAllocs(sim, query); allocs != 0 && !raceEnabled {
+		b.Fatalf("expected no allocations in steady state, got %v", allocs)
+	}
+
+	sum := 0.0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		query.ForEach(sim, func(item *forEachQuery) {
+			sum += item.A.A
+		})
+	}
+}
+
+func BenchmarkQueryForEachSimple(b *testing.B) {
+	benchmarkQueryForEach(b, NewEntitySimpleStorage(), NewQuery[forEachQuery]())
+}
+
+func BenchmarkQueryForEachArchetype(b *testing.B) {
+	benchmarkQueryForEach(b, NewEntityArchetypeStorage(), NewQuery[forEachQuery]())
+}
+
+func BenchmarkQueryForEachSparseSet(b *testing.B) {
+	benchmarkQueryForEach(b, NewEntitySparseSetStorage(), NewQuery[forEachQuery]())
+}
+
+func BenchmarkQueryForEachCached(b *testing.B) {
+	benchmarkQueryForEach(b, NewEntitySparseSetStorage(), NewQuery[forEachQuery]().Cached())
+}
+
+func BenchmarkQueryForEachRelation(b *testing.B) {
+	sim := newForEachRelationSimulation(NewEntityArchetypeStorage(), 10000)
+	query := NewQuery[forEachRelationQuery]()
+	if allocs := forEachRelationAllocs(sim, query); allocs != 0 && !raceEnabled {
+		b.Fatalf("expected no allocations in steady state, got %v", allocs)
+	}
+
+	targets := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		query.ForEach(sim, func(item *forEachRelationQuery) {
+			targets += len(item.Likes.Targets)
+		})
+	}
+}
+
+func BenchmarkQueryExecute(b *testing.B) {
+	sim := newForEachSimulation(NewEntitySparseSetStorage(), 10000)
+	query := NewQuery[forEachQuery]()
+
+	sum := 0.0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		iter := query.Execute(sim)
+		for iter.Next() {
+			sum += iter.Item.A.A
+		}
+	}
+}
+
+type sortedQuery struct {
+	Id EntityId
+	A  *componentA
+	B  *componentB `ecs:"mut"`
+}
+
+func sortedIds(items []sortedQuery) []EntityId {
+	result := make([]EntityId, len(items))
+	for index, item := range items {
+		result[index] = item.Id
+	}
+	return result
+}
+
+func TestQuerySortBy(t *testing.T) {
+	sim := NewSimpleSimulation()
+	third := sim.AddEntity(&componentA{A: 3}, &componentB{})
+	first := sim.AddEntity(&componentA{A: 1}, &componentB{})
+	second := sim.AddEntity(&componentA{A: 2}, &componentB{})
+
+	since := sim.Storage.ChangeTick()
+	sim.Storage.AdvanceChangeTick()
+	result := NewQuery[sortedQuery]().Execute(sim)
+	result.SortBy(func(a, b *sortedQuery) bool {
+		return a.A.A < b.A.A
+	})
+	ticks, _ := sim.Storage.ComponentTicks(first, componentBId)
+	assert.Equal(t, since, ticks.Changed, "sorting should not mark components as changed")
+	assert.Equal(t, []EntityId{first, second, third}, sortedIds(result.ToList()))
+}
+
+func TestSortedQuery(t *testing.T) {
+	sim := NewSimpleSimulation()
+	ids := make([]EntityId, 5)
+	for n := range ids {
+		ids[n] = sim.AddEntity(&componentA{A: float64(10 - n)}, &componentB{})
+	}
+	equal := sim.AddEntity(&componentA{A: 8.5}, &componentB{})
+
+	query := NewQuery[sortedQuery]().Sorted(func(a, b *sortedQuery) bool {
+		return a.A.A < b.A.A
+	})
+	assert.Equal(t, []EntityId{ids[4], ids[3], ids[2], equal, ids[1], ids[0]}, sortedIds(query.Execute(sim).ToList()))
+
+	// entities keep their order as values change, are added, and are removed. the storage
+	// matches entities in no particular order, so equal values are only introduced once the
+	// order is known
+	a, _ := Get[componentA](sim, ids[0])
+	a.A = 0
+	a, _ = Get[componentA](sim, equal)
+	a.A = 8
+	added := sim.AddEntity(&componentA{A: 7.5}, &componentB{})
+	sim.DeleteEntity(ids[3])
+
+	visited := []EntityId{}
+	for id := range query.Execute(sim).All() {
+		visited = append(visited, id)
+	}
+	assert.Equal(t, []EntityId{ids[0], ids[4], added, ids[2], equal, ids[1]}, visited)
+
+	// entities which stop matching are dropped
+	Remove[componentA](sim, ids[4])
+	assert.Equal(t, []EntityId{ids[0], added, ids[2], equal, ids[1]}, sortedIds(query.Execute(sim).ToList()))
+	assert.NotNil(t, query.Access().Write)
+}
+
+func TestSortedQueryResorts(t *testing.T) {
+	sim := NewSimpleSimulation()
+	for n := 0; n < 500; n++ {
+		sim.AddEntity(&componentA{A: float64((n * 7919) % 101)}, &componentB{})
+	}
+
+	less := func(a, b *sortedQuery) bool {
+		return a.A.A < b.A.A
+	}
+	query := NewQuery[sortedQuery]()
+	sorted := query.Sorted(less)
+	for round := 0; round < 5; round++ {
+		// change a few values each round, and every value in the last round
+		count := 0
+		query.ForEach(sim, func(item *sortedQuery) {
+			if round == 4 || count%97 == round {
+				item.A.A = float64((int(item.A.A)*31 + round) % 101)
+			}
+			count++
+		})
+
+		actual := sorted.Execute(sim).ToList()
+		assert.ElementsMatch(t, sortedIds(query.Execute(sim).ToList()), sortedIds(actual))
+		assert.True(t, sort.SliceIsSorted(actual, func(i, j int) bool {
+			return less(&actual[i], &actual[j])
+		}), "round %d should be sorted", round)
+	}
+}
+
+func TestSortedItemsBoundsWork(t *testing.T) {
+	// appending a sorted batch to a sorted order leaves a single descent, but moving every
+	// new item into place by insertion would take quadratic time
+	values := make([]int, 4000)
+	for n := range values {
+		values[n] = (n % 2000) * 2
+		if n >= 2000 {
+			values[n]++
+		}
+	}
+
+	comparisons := 0
+	items := &sortedItems[int]{ids: make([]EntityId, len(values)), items: values, less: func(a, b *int) bool {
+		comparisons++
+		return *a < *b
+	}}
+	for n := range items.ids {
+		items.ids[n] = EntityId(values[n])
+	}
+	items.sort()
+
+	assert.True(t, sort.IntsAreSorted(values))
+	for n, value := range values {
+		assert.Equal(t, EntityId(value), items.ids[n], "ids should be sorted along with their items")
+	}
+	assert.Less(t, comparisons, 200000)
+}
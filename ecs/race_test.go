@@ -0,0 +1,7 @@
+//go:build race
+
+package ecs
+
+// raceEnabled reports whether tests are running with the race detector, which randomly drops
+// pooled values and so makes allocation counts unreliable.
+const raceEnabled = true
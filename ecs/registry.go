@@ -0,0 +1,234 @@
+package ecs
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ComponentId is a dense numeric id assigned to each registered component type. Ids are
+// assigned in the order components are registered, so they are stable across builds as long
+// as components are registered in the same order.
+type ComponentId uint32
+
+// invalidComponentId is used in place of component types which are not registered, which
+// no entity can have.
+const invalidComponentId = ^ComponentId(0)
+
+// ComponentHooks are optional callbacks run by the simulation as components are added to
+// and removed from entities.
+type ComponentHooks struct {
+	// OnAdd is called after the component is added to an entity, but not when an existing
+	// component is replaced.
+	OnAdd func(sim *Simulation, id EntityId, component interface{})
+	// OnRemove is called before the component is removed from an entity, including when
+	// the entity is deleted.
+	OnRemove func(sim *Simulation, id EntityId, component interface{})
+}
+
+// ComponentInfo describes a registered component type.
+type ComponentInfo struct {
+	Id   ComponentId
+	Name string
+	// Type is the pointer type components are stored as.
+	Type reflect.Type
+	// Size is the size of the component struct in bytes.
+	Size  uintptr
+	Hooks ComponentHooks
+}
+
+// componentRegistry assigns ids and names to component (and relation) types, allowing
+// storages to key components by id and snapshots and scenes to reconstruct them by name.
+type componentRegistry struct {
+	lock       sync.RWMutex
+	components []*ComponentInfo
+	byType     map[reflect.Type]*ComponentInfo
+	byName     map[string]*ComponentInfo
+	// types is a copy of byType which is replaced on each registration, so that components
+	// can be looked up without locking as they are added to storage
+	types atomic.Pointer[map[reflect.Type]*ComponentInfo]
+}
+
+// publish replaces the lock-free copy of the registered types, called with the lock held.
+func (r *componentRegistry) publish() {
+	types := make(map[reflect.Type]*ComponentInfo, len(r.byType))
+	for componentType, info := range r.byType {
+		types[componentType] = info
+	}
+	r.types.Store(&types)
+}
+
+var registry = &componentRegistry{
+	components: []*ComponentInfo{},
+	byType:     map[reflect.Type]*ComponentInfo{},
+	byName:     map[string]*ComponentInfo{},
+}
+
+// the builtin components are registered as package variables (rather than within init) so
+// that they are always the first ids and are available to other package variables
+var (
+	nameComponentId     = RegisterComponent[NameComponent]("Name")
+	labelComponentId    = RegisterComponent[LabelComponent]("Label")
+	parentComponentId   = RegisterComponent[ParentComponent]("Parent")
+	childrenComponentId = RegisterComponent[ChildrenComponent]("Children")
+)
+
+// RegisterComponent registers the component (or relation) type T under the given name,
+// returning its id. Components must be registered before they are added to an entity, and
+// only registered types can be saved within snapshots or loaded from scenes. Registering the
+// same type and name again returns the existing id, while reusing either for a different
+// registration panics.
+func RegisterComponent[T any](name string) ComponentId {
+	return RegisterComponentWithHooks[T](name, ComponentHooks{})
+}
+
+// RegisterComponentWithHooks registers the component type T along with hooks which are run
+// as it is added to and removed from entities.
+func RegisterComponentWithHooks[T any](name string, hooks ComponentHooks) ComponentId {
+	componentType := reflect.TypeOf((*T)(nil)).Elem()
+	if componentType.Kind() != reflect.Struct {
+		log.Panicf("component type %v registered as %v must be a struct", componentType, name)
+	}
+	pointerType := reflect.PointerTo(componentType)
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if existing, exists := registry.byName[name]; exists && existing.Type != pointerType {
+		log.Panicf("component name %v is already registered for %v", name, existing.Type.Elem())
+	}
+	if existing, exists := registry.byType[pointerType]; exists {
+		if existing.Name != name {
+			log.Panicf("component type %v is already registered as %v", componentType, existing.Name)
+		}
+
+		// registrations are replaced rather than modified as they are read without locking
+		info := *existing
+		info.Hooks = hooks
+		registry.components[info.Id] = &info
+		registry.byType[pointerType] = &info
+		registry.byName[name] = &info
+		registry.publish()
+		return info.Id
+	}
+
+	info := &ComponentInfo{
+		Id:    ComponentId(len(registry.components)),
+		Name:  name,
+		Type:  pointerType,
+		Size:  componentType.Size(),
+		Hooks: hooks,
+	}
+	registry.components = append(registry.components, info)
+	registry.byType[pointerType] = info
+	registry.byName[name] = info
+	registry.publish()
+	return info.Id
+}
+
+// ComponentIdOf returns the id of the component type T, or false if it is not registered.
+func ComponentIdOf[T any]() (ComponentId, bool) {
+	info, exists := componentInfoOf[T]()
+	if !exists {
+		return invalidComponentId, false
+	}
+	return info.Id, true
+}
+
+// GetComponentInfo returns the registration of a component id.
+func GetComponentInfo(id ComponentId) (ComponentInfo, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if int(id) >= len(registry.components) {
+		return ComponentInfo{}, false
+	}
+	return *registry.components[id], true
+}
+
+// RegisteredComponents returns every registered component, ordered by id.
+func RegisteredComponents() []ComponentInfo {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	result := make([]ComponentInfo, len(registry.components))
+	for index, info := range registry.components {
+		result[index] = *info
+	}
+	return result
+}
+
+// ComponentTypeByName returns the struct type registered under the given name.
+func ComponentTypeByName(name string) (reflect.Type, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	info, exists := registry.byName[name]
+	if !exists {
+		return nil, false
+	}
+	return info.Type.Elem(), true
+}
+
+// ComponentName returns the name a component type was registered under. The type may be
+// given either as the struct type or a pointer to it.
+func ComponentName(componentType reflect.Type) (string, bool) {
+	info, exists := lookupComponentType(normalizeComponentType(componentType))
+	if !exists {
+		return "", false
+	}
+	return info.Name, true
+}
+
+// lookupComponentType returns the registration of a component pointer type.
+func lookupComponentType(componentType reflect.Type) (*ComponentInfo, bool) {
+	types := registry.types.Load()
+	if types == nil {
+		return nil, false
+	}
+
+	info, exists := (*types)[componentType]
+	return info, exists
+}
+
+// componentInfoOf returns the registration of the component type T.
+func componentInfoOf[T any]() (*ComponentInfo, bool) {
+	return lookupComponentType(reflect.TypeOf((*T)(nil)))
+}
+
+// componentIdOf returns the id of a component pointer type, or invalidComponentId if it is
+// not registered.
+func componentIdOf(componentType reflect.Type) ComponentId {
+	info, exists := lookupComponentType(componentType)
+	if !exists {
+		return invalidComponentId
+	}
+	return info.Id
+}
+
+// resolveComponent returns the registration of a component which is being added to storage,
+// along with the component as a pointer. Components passed by value are copied into a new
+// pointer, as storages and queries always hold components by pointer.
+func resolveComponent(component interface{}) (interface{}, *ComponentInfo, error) {
+	value := reflect.ValueOf(component)
+	if value.Kind() == reflect.Struct {
+		pointer := reflect.New(value.Type())
+		pointer.Elem().Set(value)
+		value = pointer
+	}
+
+	if value.Kind() != reflect.Pointer || value.Type().Elem().Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("%w: component %v must be a struct or a pointer to a struct", ErrInvalidComponentType, reflect.TypeOf(component))
+	}
+	if value.IsNil() {
+		return nil, nil, fmt.Errorf("%w: component %v must not be nil", ErrInvalidComponentType, value.Type())
+	}
+
+	info, exists := lookupComponentType(value.Type())
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: component type %v is not registered, see RegisterComponent", ErrInvalidComponentType, value.Type().Elem())
+	}
+	return value.Interface(), info, nil
+}
@@ -0,0 +1,103 @@
+package ecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hookedComponent struct {
+	value int
+}
+
+type lateComponent struct {
+	value int
+}
+
+type unregisteredComponent struct{}
+
+func TestRegistryComponentInfo(t *testing.T) {
+	info, ok := GetComponentInfo(testComponentId)
+	assert.True(t, ok)
+	assert.Equal(t, "test.Test", info.Name)
+	assert.Equal(t, reflect.TypeOf(&testComponent{}), info.Type)
+	assert.Equal(t, reflect.TypeOf(testComponent{}).Size(), info.Size)
+
+	id, ok := ComponentIdOf[testComponent]()
+	assert.True(t, ok)
+	assert.Equal(t, testComponentId, id)
+	assert.Equal(t, testComponentId, RegisterComponent[testComponent]("test.Test"), "registering again should return the same id")
+
+	_, ok = ComponentIdOf[unregisteredComponent]()
+	assert.False(t, ok)
+	_, ok = GetComponentInfo(invalidComponentId)
+	assert.False(t, ok)
+
+	// ids are dense and ordered by registration, starting with the builtin components
+	for index, info := range RegisteredComponents() {
+		assert.Equal(t, ComponentId(index), info.Id)
+	}
+	assert.Equal(t, ComponentId(0), nameComponentId)
+
+	assert.Panics(t, func() { RegisterComponent[testComponent]("test.Renamed") })
+	assert.Panics(t, func() { RegisterComponent[otherComponent]("test.Test") })
+	assert.Panics(t, func() { RegisterComponent[int]("test.Int") })
+}
+
+func TestRegistryRejectsInvalidComponents(t *testing.T) {
+	for _, storage := range []EntityStorage{NewEntitySimpleStorage(), NewEntityArchetypeStorage(), NewEntitySparseSetStorage()} {
+		assert.ErrorContains(t, storage.Add(1, &unregisteredComponent{}), "not registered")
+		assert.ErrorContains(t, storage.Add(1, 5), "must be a struct")
+		assert.ErrorContains(t, storage.Add(1, (*testComponent)(nil)), "must not be nil")
+		assert.Len(t, storage.FindAll(QueryFilter{}), 0, "invalid entities should not be added")
+
+		assert.NoError(t, storage.Add(1, &testComponent{}))
+		assert.ErrorContains(t, storage.AddComponent(1, &unregisteredComponent{}), "not registered")
+		assert.Len(t, storage.Get(1), 1)
+	}
+
+	sim := NewSimpleSimulation()
+	assert.Panics(t, func() { sim.AddEntity(&unregisteredComponent{}) })
+	id := sim.AddEntity()
+	assert.Error(t, sim.TryAddComponent(id, &unregisteredComponent{}))
+	assert.False(t, sim.GetComponent(id, &unregisteredComponent{}))
+}
+
+func TestRegistryHooks(t *testing.T) {
+	added := []int{}
+	removed := []int{}
+	RegisterComponentWithHooks[hookedComponent]("test.Hooked", ComponentHooks{
+		OnAdd: func(sim *Simulation, id EntityId, component interface{}) {
+			added = append(added, component.(*hookedComponent).value)
+		},
+		OnRemove: func(sim *Simulation, id EntityId, component interface{}) {
+			assert.True(t, sim.IsAlive(id), "remove hooks should run before the entity is deleted")
+			removed = append(removed, component.(*hookedComponent).value)
+		},
+	})
+
+	sim := NewSimpleSimulation()
+	first := sim.AddEntity(&hookedComponent{value: 1})
+	second := sim.AddEntity()
+	assert.NoError(t, sim.TryAddComponent(second, &hookedComponent{value: 2}))
+	assert.NoError(t, sim.TryAddComponent(second, &hookedComponent{value: 3}), "replacing a component should not run hooks")
+	assert.Equal(t, []int{1, 2}, added)
+
+	sim.RemoveComponent(second, hookedComponent{})
+	sim.DeleteEntity(first)
+	assert.Equal(t, []int{3, 1}, removed)
+}
+
+func TestQueryResolvesLateRegistrations(t *testing.T) {
+	// queries are often package variables created before their components are registered
+	query := NewQuery[struct{ Late *lateComponent }]()
+	sim := NewSimpleSimulation()
+	assert.Len(t, query.Execute(sim).ToList(), 0)
+
+	RegisterComponent[lateComponent]("test.Late")
+	sim.AddEntity(&lateComponent{value: 5})
+	items := query.Execute(sim).ToList()
+	assert.Len(t, items, 1)
+	assert.Equal(t, 5, items[0].Late.value)
+}
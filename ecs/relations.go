@@ -0,0 +1,276 @@
+package ecs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+// RelationFilter matches entities which have a relation of the given type. If Target is
+// zero the relation may be to any target, otherwise it must be to that target.
+type RelationFilter struct {
+	Relation ComponentId
+	Target   EntityId
+}
+
+type relationPair struct {
+	relation ComponentId
+	target   EntityId
+}
+
+// relationIndex stores relation pairs between entities, indexed in both directions. It is
+// embedded by every storage so that relations share the lifetime of their entities.
+// Relation types are registered like components, and pairs are keyed by their id.
+type relationIndex struct {
+	// targets of each relation for every source entity, in the order they where added
+	targets map[EntityId]map[ComponentId][]EntityId
+	// sources of each relation pair, in the order they where added
+	sources map[relationPair][]EntityId
+	// incoming relation types which target each entity, so they can be removed on deletion
+	incoming map[EntityId]map[ComponentId]struct{}
+}
+
+func newRelationIndex() relationIndex {
+	return relationIndex{
+		targets:  map[EntityId]map[ComponentId][]EntityId{},
+		sources:  map[relationPair][]EntityId{},
+		incoming: map[EntityId]map[ComponentId]struct{}{},
+	}
+}
+
+func removeEntityId(ids []EntityId, id EntityId) ([]EntityId, bool) {
+	for index, existing := range ids {
+		if existing == id {
+			return append(ids[:index], ids[index+1:]...), true
+		}
+	}
+	return ids, false
+}
+
+// AddRelation adds a relation pair from the source entity to the target entity.
+func (r *relationIndex) AddRelation(source EntityId, relation ComponentId, target EntityId) {
+	if r.HasRelation(source, relation, target) {
+		return
+	}
+
+	relations, exists := r.targets[source]
+	if !exists {
+		relations = map[ComponentId][]EntityId{}
+		r.targets[source] = relations
+	}
+	relations[relation] = append(relations[relation], target)
+
+	pair := relationPair{relation: relation, target: target}
+	r.sources[pair] = append(r.sources[pair], source)
+
+	incoming, exists := r.incoming[target]
+	if !exists {
+		incoming = map[ComponentId]struct{}{}
+		r.incoming[target] = incoming
+	}
+	incoming[relation] = struct{}{}
+}
+
+// RemoveRelation removes a relation pair from the source entity to the target entity.
+func (r *relationIndex) RemoveRelation(source EntityId, relation ComponentId, target EntityId) {
+	relations := r.targets[source]
+	targets, removed := removeEntityId(relations[relation], target)
+	if !removed {
+		return
+	}
+
+	if len(targets) == 0 {
+		delete(relations, relation)
+		if len(relations) == 0 {
+			delete(r.targets, source)
+		}
+	} else {
+		relations[relation] = targets
+	}
+
+	pair := relationPair{relation: relation, target: target}
+	sources, _ := removeEntityId(r.sources[pair], source)
+	if len(sources) == 0 {
+		delete(r.sources, pair)
+		delete(r.incoming[target], relation)
+		if len(r.incoming[target]) == 0 {
+			delete(r.incoming, target)
+		}
+	} else {
+		r.sources[pair] = sources
+	}
+}
+
+// HasRelation returns whether the source entity has the relation to the target, or to any
+// target if the target is zero.
+func (r *relationIndex) HasRelation(source EntityId, relation ComponentId, target EntityId) bool {
+	targets := r.targets[source][relation]
+	if target == 0 {
+		return len(targets) > 0
+	}
+
+	for _, existing := range targets {
+		if existing == target {
+			return true
+		}
+	}
+	return false
+}
+
+// RelationTargets returns the targets of the source entity's relations of the given type.
+func (r *relationIndex) RelationTargets(source EntityId, relation ComponentId) []EntityId {
+	return append([]EntityId{}, r.targets[source][relation]...)
+}
+
+// appendRelationTargets appends the targets of the source entity's relations of the given
+// type to the result, allowing queries to reuse a buffer rather than copying them.
+func (r *relationIndex) appendRelationTargets(result []EntityId, source EntityId, relation ComponentId) []EntityId {
+	return append(result, r.targets[source][relation]...)
+}
+
+// RelationSources returns the entities with a relation of the given type to the target.
+func (r *relationIndex) RelationSources(relation ComponentId, target EntityId) []EntityId {
+	return append([]EntityId{}, r.sources[relationPair{relation: relation, target: target}]...)
+}
+
+// Relations returns every relation pair of the source entity, ordered by relation id and
+// then by the order they where added.
+func (r *relationIndex) Relations(source EntityId) []RelationFilter {
+	relations := make([]ComponentId, 0, len(r.targets[source]))
+	for relation := range r.targets[source] {
+		relations = append(relations, relation)
+	}
+	sort.Slice(relations, func(a int, b int) bool {
+		return relations[a] < relations[b]
+	})
+
+	result := []RelationFilter{}
+	for _, relation := range relations {
+		for _, target := range r.targets[source][relation] {
+			result = append(result, RelationFilter{Relation: relation, Target: target})
+		}
+	}
+	return result
+}
+
+// deleteRelations removes every relation from the entity, and every relation which targets
+// it, called when the entity is deleted from storage.
+func (r *relationIndex) deleteRelations(id EntityId) {
+	for relation, targets := range r.targets[id] {
+		for _, target := range append([]EntityId{}, targets...) {
+			r.RemoveRelation(id, relation, target)
+		}
+	}
+
+	for relation := range r.incoming[id] {
+		for _, source := range r.RelationSources(relation, id) {
+			r.RemoveRelation(source, relation, id)
+		}
+	}
+}
+
+// matchesRelations returns whether the entity matches the relations of the filter.
+func (r *relationIndex) matchesRelations(filter QueryFilter, id EntityId) bool {
+	for _, term := range filter.Relations {
+		if !r.HasRelation(id, term.Relation, term.Target) {
+			return false
+		}
+	}
+
+	for _, relation := range filter.WithoutRelations {
+		if r.HasRelation(id, relation, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// relationField is implemented by Relation, allowing queries to detect relation fields.
+type relationField interface {
+	relationType() reflect.Type
+}
+
+var relationFieldType = reflect.TypeOf((*relationField)(nil)).Elem()
+
+/// Relation is a query field which matches entities with a relation of type R, and is filled
+///  with the targets of those relations. Like components, relation fields may be tagged with
+///  `ecs:"optional"` or `ecs:"without"`. Queries which reuse their items (such as ForEach)
+///  also reuse Targets, so it must be copied to be kept.
+type Relation[R any] struct {
+	Targets []EntityId
+}
+
+// relationType returns the pointer type R is registered under, which is resolved to its id
+// when queries are first run.
+func (r Relation[R]) relationType() reflect.Type {
+	return reflect.TypeOf((*R)(nil))
+}
+
+// relationIdOf returns the id of the relation type R, or invalidComponentId if it is not
+// registered, which no entity can have a relation of.
+func relationIdOf[R any]() ComponentId {
+	return componentIdOf(reflect.TypeOf((*R)(nil)))
+}
+
+// relationTargetStorage is implemented by storages which can append relation targets to a
+// buffer, which every storage embedding relationIndex does.
+type relationTargetStorage interface {
+	appendRelationTargets(result []EntityId, source EntityId, relation ComponentId) []EntityId
+}
+
+// setRelationTargets sets the targets of a Relation field, which always begins with Targets.
+func setRelationTargets(field unsafe.Pointer, targets []EntityId) {
+	*(*[]EntityId)(field) = targets
+}
+
+// reuseRelationTargets sets the targets of a Relation field, reusing the slice it already
+// holds if the storage supports it.
+func reuseRelationTargets(field unsafe.Pointer, storage EntityStorage, source EntityId, relation ComponentId) {
+	targets, ok := storage.(relationTargetStorage)
+	if !ok {
+		setRelationTargets(field, storage.RelationTargets(source, relation))
+		return
+	}
+	buffer := (*[]EntityId)(field)
+	*buffer = targets.appendRelationTargets((*buffer)[:0], source, relation)
+}
+
+// AddRelation adds a relation of type R from the source entity to the target entity. R must
+// be registered with RegisterComponent, otherwise an error wrapping ErrInvalidComponentType
+// is returned.
+func AddRelation[R any](sim *Simulation, source EntityId, target EntityId) error {
+	relation := relationIdOf[R]()
+	if relation == invalidComponentId {
+		return fmt.Errorf("%w: relation type %v is not registered, see RegisterComponent", ErrInvalidComponentType, reflect.TypeOf((*R)(nil)).Elem())
+	}
+	if err := sim.checkEntity(source); err != nil {
+		return fmt.Errorf("cannot add relation from entity %v: %w", source, err)
+	}
+	if err := sim.checkEntity(target); err != nil {
+		return fmt.Errorf("cannot add relation to entity %v: %w", target, err)
+	}
+
+	sim.Storage.AddRelation(source, relation, target)
+	return nil
+}
+
+// RemoveRelation removes the relation of type R from the source entity to the target entity.
+func RemoveRelation[R any](sim *Simulation, source EntityId, target EntityId) {
+	sim.Storage.RemoveRelation(source, relationIdOf[R](), target)
+}
+
+// HasRelation returns whether the source entity has a relation of type R to the target.
+func HasRelation[R any](sim *Simulation, source EntityId, target EntityId) bool {
+	return sim.Storage.HasRelation(source, relationIdOf[R](), target)
+}
+
+// RelationTargets returns the targets of the source entity's relations of type R.
+func RelationTargets[R any](sim *Simulation, source EntityId) []EntityId {
+	return sim.Storage.RelationTargets(source, relationIdOf[R]())
+}
+
+// RelationSources returns the entities with a relation of type R to the target entity.
+func RelationSources[R any](sim *Simulation, target EntityId) []EntityId {
+	return sim.Storage.RelationSources(relationIdOf[R](), target)
+}
@@ -0,0 +1,80 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelations(t *testing.T) {
+	sim := NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor())
+	station := sim.AddEntity(&NameComponent{Name: "station"})
+	otherStation := sim.AddEntity(&NameComponent{Name: "other station"})
+	ship := sim.AddEntity(&NameComponent{Name: "ship"})
+	otherShip := sim.AddEntity(&NameComponent{Name: "other ship"})
+	freighter := sim.AddEntity(&NameComponent{Name: "freighter"})
+
+	assert.NoError(t, AddRelation[dockedAtRelation](sim, ship, station))
+	assert.NoError(t, AddRelation[dockedAtRelation](sim, otherShip, otherStation))
+	assert.NoError(t, AddRelation[likesRelation](sim, ship, otherShip))
+	assert.True(t, HasRelation[dockedAtRelation](sim, ship, station))
+	assert.Equal(t, []EntityId{ship}, RelationSources[dockedAtRelation](sim, station))
+
+	docked := NewQuery[struct {
+		Id       EntityId
+		Name     *NameComponent
+		DockedAt Relation[dockedAtRelation]
+		Likes    Relation[likesRelation] `ecs:"optional"`
+	}]()
+	list := docked.Execute(sim).ToList()
+	assert.Len(t, list, 2)
+	for _, item := range list {
+		if item.Id == ship {
+			assert.Equal(t, []EntityId{station}, item.DockedAt.Targets)
+			assert.Equal(t, []EntityId{otherShip}, item.Likes.Targets)
+		} else {
+			assert.Equal(t, []EntityId{otherStation}, item.DockedAt.Targets)
+			assert.Len(t, item.Likes.Targets, 0)
+		}
+	}
+
+	atStation := WithRelationTarget[dockedAtRelation](docked, station).Execute(sim).ToList()
+	assert.Len(t, atStation, 1)
+	assert.Equal(t, ship, atStation[0].Id)
+	assert.Len(t, docked.Execute(sim).ToList(), 2, "narrowing a query should not modify the original")
+
+	undocked := NewQuery[struct {
+		Id       EntityId
+		DockedAt Relation[dockedAtRelation] `ecs:"without"`
+	}]().Execute(sim).ToList()
+	assert.Len(t, undocked, 3)
+
+	assert.Error(t, AddRelation[dockedAtRelation](sim, freighter, EntityId(1000)))
+	assert.ErrorIs(t, AddRelation[unregisteredComponent](sim, freighter, station), ErrInvalidComponentType)
+	assert.False(t, HasRelation[unregisteredComponent](sim, freighter, 0))
+
+	sim.DeleteEntity(station)
+	assert.False(t, HasRelation[dockedAtRelation](sim, ship, station), "pairs should be removed with their target")
+	assert.Len(t, docked.Execute(sim).ToList(), 1)
+}
+
+func TestRelationTargetCache(t *testing.T) {
+	sim := NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor())
+	station := sim.AddEntity(&NameComponent{Name: "station"})
+	ship := sim.AddEntity(&NameComponent{Name: "ship"})
+	assert.NoError(t, AddRelation[dockedAtRelation](sim, ship, station))
+
+	docked := NewQuery[struct {
+		Id       EntityId
+		DockedAt Relation[dockedAtRelation]
+	}]().Cached()
+	atStation := WithRelationTarget[dockedAtRelation](docked, station)
+	assert.Len(t, docked.Execute(sim).ToList(), 1)
+	assert.Len(t, atStation.Execute(sim).ToList(), 1)
+
+	// each query has its own cache, so releasing one leaves the other registered
+	atStation.ReleaseCache(sim.Storage)
+	assert.Len(t, atStation.caches.caches, 0)
+	assert.Len(t, docked.caches.caches, 1)
+	assert.Len(t, docked.Execute(sim).ToList(), 1)
+}
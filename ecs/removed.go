@@ -0,0 +1,99 @@
+package ecs
+
+import (
+	"reflect"
+	"sync"
+)
+
+type removedComponent struct {
+	id        EntityId
+	component interface{}
+}
+
+// removalEvents records the components removed from entities and the entities which where
+// deleted, so that systems maintaining state outside of the simulation can clean it up.
+type removalEvents struct {
+	lock       sync.RWMutex
+	components map[reflect.Type]*eventBuffer[removedComponent]
+	despawned  *eventBuffer[EntityId]
+}
+
+func newRemovalEvents() *removalEvents {
+	return &removalEvents{
+		components: map[reflect.Type]*eventBuffer[removedComponent]{},
+		despawned:  newEventBuffer[EntityId](),
+	}
+}
+
+func (r *removalEvents) buffer(componentType reflect.Type) *eventBuffer[removedComponent] {
+	r.lock.RLock()
+	buffer, exists := r.components[componentType]
+	r.lock.RUnlock()
+	if exists {
+		return buffer
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if buffer, exists = r.components[componentType]; !exists {
+		buffer = newEventBuffer[removedComponent]()
+		r.components[componentType] = buffer
+	}
+	return buffer
+}
+
+// removed records that a component was removed from an entity, which must be called before
+// the component is removed from storage. Storages only hold pointers to components, so the
+// component type is always the pointer type of the component. The component is copied as
+// storages may reuse its memory once it is removed (see EntityArchetypeStorage).
+func (r *removalEvents) removed(id EntityId, componentType reflect.Type, component interface{}) {
+	copied := reflect.New(componentType.Elem())
+	copied.Elem().Set(reflect.ValueOf(component).Elem())
+	r.buffer(componentType).push(removedComponent{id: id, component: copied.Interface()})
+}
+
+func (r *removalEvents) swap() {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, buffer := range r.components {
+		buffer.swap()
+	}
+	r.despawned.swap()
+}
+
+// Removed is a component which was removed from an entity, either directly or because the
+// entity was deleted.
+type Removed[T any] struct {
+	Id        EntityId
+	Component *T
+}
+
+// RemovedComponents reads the components of type T removed from entities. Each reader keeps
+// its own position, so systems should store their reader and call Read every update to see
+// every removal exactly once. Removals are kept for two updates.
+type RemovedComponents[T any] struct {
+	cursor uint64
+}
+
+// Read returns the components removed since the last call to Read.
+func (r *RemovedComponents[T]) Read(sim *Simulation) []Removed[T] {
+	events := sim.removals.buffer(reflect.TypeOf((*T)(nil))).read(&r.cursor)
+
+	result := make([]Removed[T], len(events))
+	for index, event := range events {
+		result[index] = Removed[T]{Id: event.id, Component: event.component.(*T)}
+	}
+	return result
+}
+
+// DespawnedEntities reads the ids of deleted entities. Like RemovedComponents each reader
+// keeps its own position.
+type DespawnedEntities struct {
+	cursor uint64
+}
+
+// Read returns the entities deleted since the last call to Read.
+func (d *DespawnedEntities) Read(sim *Simulation) []EntityId {
+	return sim.removals.despawned.read(&d.cursor)
+}
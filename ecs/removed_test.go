@@ -0,0 +1,54 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemovedComponents(t *testing.T) {
+	sim := NewSimpleSimulation()
+	first := sim.AddEntity(&testComponent{a: 1}, &otherComponent{x: 1})
+	second := sim.AddEntity(&testComponent{a: 2})
+
+	reader := &RemovedComponents[testComponent]{}
+	otherReader := &RemovedComponents[testComponent]{}
+	despawned := &DespawnedEntities{}
+	assert.Len(t, reader.Read(sim), 0)
+
+	sim.RemoveComponent(first, testComponent{})
+	sim.RemoveComponent(first, testComponent{})
+	sim.DeleteEntity(second)
+
+	removed := reader.Read(sim)
+	assert.Equal(t, []Removed[testComponent]{
+		{Id: first, Component: &testComponent{a: 1}},
+		{Id: second, Component: &testComponent{a: 2}},
+	}, removed, "removing a missing component should not be reported")
+	assert.Len(t, reader.Read(sim), 0, "readers should only see each removal once")
+	assert.Len(t, otherReader.Read(sim), 2, "readers should not steal removals from each other")
+	assert.Equal(t, []EntityId{second}, despawned.Read(sim))
+	assert.Len(t, (&RemovedComponents[otherComponent]{}).Read(sim), 0)
+}
+
+func TestRemovedComponentsLifetime(t *testing.T) {
+	sim := NewSimpleSimulation()
+	assert.NoError(t, sim.Setup())
+
+	reader := &DespawnedEntities{}
+	late := &DespawnedEntities{}
+
+	first := sim.AddEntity(&testComponent{})
+	sim.DeleteEntity(first)
+	sim.Update()
+	assert.Equal(t, []EntityId{first}, reader.Read(sim), "removals should be kept after one update")
+
+	second := sim.AddEntity(&testComponent{})
+	sim.Frame.Commands.Despawn(second)
+	sim.Update()
+	assert.Equal(t, []EntityId{second}, reader.Read(sim))
+	assert.Equal(t, []EntityId{second}, late.Read(sim), "removals should be dropped after two updates")
+
+	sim.Update()
+	assert.Len(t, reader.Read(sim), 0)
+}
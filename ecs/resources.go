@@ -0,0 +1,72 @@
+package ecs
+
+import (
+	"log"
+	"reflect"
+	"sort"
+)
+
+func resourceType[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// InsertResource stores a global resource of type T within the simulation, replacing any
+// existing resource of the same type. Systems access resources with Resource, and should
+// declare them within their SystemAccess so that executors can schedule around them.
+func InsertResource[T any](sim *Simulation, resource T) *T {
+	result := &resource
+
+	sim.resourceLock.Lock()
+	sim.resources[resourceType[T]()] = result
+	sim.resourceLock.Unlock()
+	return result
+}
+
+// TryResource returns the resource of type T, or false if it does not exist.
+func TryResource[T any](sim *Simulation) (*T, bool) {
+	sim.resourceLock.RLock()
+	resource, exists := sim.resources[resourceType[T]()]
+	sim.resourceLock.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+	return resource.(*T), true
+}
+
+// Resource returns the resource of type T, panicking if it does not exist.
+func Resource[T any](sim *Simulation) *T {
+	resource, exists := TryResource[T](sim)
+	if !exists {
+		log.Panicf("resource %v does not exist", resourceType[T]())
+	}
+	return resource
+}
+
+// RemoveResource removes the resource of type T, returning it if it existed.
+func RemoveResource[T any](sim *Simulation) (*T, bool) {
+	sim.resourceLock.Lock()
+	defer sim.resourceLock.Unlock()
+
+	resource, exists := sim.resources[resourceType[T]()]
+	if !exists {
+		return nil, false
+	}
+	delete(sim.resources, resourceType[T]())
+	return resource.(*T), true
+}
+
+// Resources returns a pointer to every resource within the simulation, ordered by type name.
+func (s *Simulation) Resources() []interface{} {
+	s.resourceLock.RLock()
+	result := make([]interface{}, 0, len(s.resources))
+	for _, resource := range s.resources {
+		result = append(result, resource)
+	}
+	s.resourceLock.RUnlock()
+
+	sort.Slice(result, func(a int, b int) bool {
+		return reflect.TypeOf(result[a]).Elem().String() < reflect.TypeOf(result[b]).Elem().String()
+	})
+	return result
+}
@@ -0,0 +1,65 @@
+package ecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type gameTime struct {
+	elapsed float64
+}
+
+type score int
+
+func TestResources(t *testing.T) {
+	sim := NewSimpleSimulation()
+
+	_, exists := TryResource[gameTime](sim)
+	assert.False(t, exists)
+	assert.Panics(t, func() { Resource[gameTime](sim) })
+
+	InsertResource(sim, gameTime{elapsed: 1})
+	InsertResource[score](sim, 10)
+
+	Resource[gameTime](sim).elapsed += 1
+	assert.Equal(t, 2.0, Resource[gameTime](sim).elapsed, "resources should be mutable in place")
+	assert.Equal(t, score(10), *Resource[score](sim))
+
+	InsertResource(sim, gameTime{elapsed: 5})
+	assert.Equal(t, 5.0, Resource[gameTime](sim).elapsed, "inserting should replace the existing resource")
+
+	resources := sim.Resources()
+	assert.Len(t, resources, 2)
+	assert.IsType(t, &gameTime{}, resources[0])
+	assert.IsType(t, new(score), resources[1])
+
+	removed, exists := RemoveResource[gameTime](sim)
+	assert.True(t, exists)
+	assert.Equal(t, 5.0, removed.elapsed)
+	_, exists = RemoveResource[gameTime](sim)
+	assert.False(t, exists)
+	assert.Len(t, sim.Resources(), 1)
+}
+
+func TestParallelExecutorScheduleResources(t *testing.T) {
+	timeType := reflect.TypeOf(gameTime{})
+	scoreType := reflect.TypeOf(score(0))
+
+	readTime := &rendezvousSystem{access: SystemAccess{ReadResources: []reflect.Type{timeType}}}
+	readTimeAgain := &rendezvousSystem{access: SystemAccess{ReadResources: []reflect.Type{timeType}}}
+	writeScore := &rendezvousSystem{access: SystemAccess{WriteResources: []reflect.Type{scoreType}}}
+	writeTime := &rendezvousSystem{access: SystemAccess{WriteResources: []reflect.Type{timeType}}}
+	// components and resources of the same type never conflict
+	writeComponent := &rendezvousSystem{access: SystemAccess{Write: []reflect.Type{timeType}}}
+
+	executor := NewParallelSystemExecutor()
+	executor.Add(readTime, readTimeAgain, writeScore, writeTime, writeComponent)
+	assert.NoError(t, executor.schedule())
+
+	assert.Equal(t, [][]System{
+		{readTime, readTimeAgain, writeScore, writeComponent},
+		{writeTime},
+	}, batchedSystems(executor))
+}
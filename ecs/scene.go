@@ -0,0 +1,360 @@
+package ecs
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SceneError is a validation error within a scene document, pointing at the offending line.
+type SceneError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SceneError) Error() string {
+	return fmt.Sprintf("%v:%v:%v: %v", e.File, e.Line, e.Column, e.Message)
+}
+
+// sceneComponent is a single component within a scene, made up of the field values given
+// by each prefab it inherits from, ordered from the base prefab to the most specific.
+type sceneComponent struct {
+	componentType reflect.Type
+	layers        []*yaml.Node
+}
+
+type scenePrefab struct {
+	name    string
+	extends *yaml.Node
+	// components maps component names to their fields, in the order they where written
+	components map[string]*yaml.Node
+	order      []string
+}
+
+/// Scene is a declarative set of prefabs and entities loaded from a JSON or YAML document.
+///  Components are given by the name they where registered with (see RegisterComponent),
+///  mapping field names to values. Prefabs may extend another prefab, overriding individual
+///  fields of its components, and entities may be instantiated from a prefab.
+///
+///    prefabs:
+///      Ship:
+///        components:
+///          Health: {Current: 10, Total: 10}
+///      Fighter:
+///        extends: Ship
+///        components:
+///          Health: {Current: 5}
+///    entities:
+///      - prefab: Fighter
+///        components:
+///          Position: {X: 5, Y: 10}
+type Scene struct {
+	file        string
+	prefabs     map[string]*scenePrefab
+	prefabNames []string
+	entities    []*scenePrefab
+}
+
+// LoadSceneFile reads and validates a scene from a JSON or YAML file.
+func LoadSceneFile(path string) (*Scene, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScene(path, data)
+}
+
+// ParseScene parses and validates a scene from a JSON or YAML document. The file name is
+// only used within errors.
+func ParseScene(file string, data []byte) (*Scene, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+
+	scene := &Scene{
+		file:        file,
+		prefabs:     map[string]*scenePrefab{},
+		prefabNames: []string{},
+		entities:    []*scenePrefab{},
+	}
+	if len(root.Content) == 0 {
+		return scene, nil
+	}
+
+	document := root.Content[0]
+	if document.Kind != yaml.MappingNode {
+		return nil, scene.errorf(document, "expected a mapping of prefabs and entities")
+	}
+
+	for index := 0; index+1 < len(document.Content); index += 2 {
+		key, value := document.Content[index], document.Content[index+1]
+		switch key.Value {
+		case "prefabs":
+			if value.Kind != yaml.MappingNode {
+				return nil, scene.errorf(value, "expected a mapping of prefab names to prefabs")
+			}
+			for prefabIdx := 0; prefabIdx+1 < len(value.Content); prefabIdx += 2 {
+				name := value.Content[prefabIdx]
+				if _, exists := scene.prefabs[name.Value]; exists {
+					return nil, scene.errorf(name, "duplicate prefab %v", name.Value)
+				}
+
+				prefab, err := scene.parseEntry(name.Value, value.Content[prefabIdx+1])
+				if err != nil {
+					return nil, err
+				}
+				scene.prefabs[name.Value] = prefab
+				scene.prefabNames = append(scene.prefabNames, name.Value)
+			}
+		case "entities":
+			if value.Kind != yaml.SequenceNode {
+				return nil, scene.errorf(value, "expected a list of entities")
+			}
+			for _, node := range value.Content {
+				entity, err := scene.parseEntry("", node)
+				if err != nil {
+					return nil, err
+				}
+				scene.entities = append(scene.entities, entity)
+			}
+		default:
+			return nil, scene.errorf(key, "unknown key %v", key.Value)
+		}
+	}
+
+	// build every prefab and entity once so that errors are reported when loading
+	for _, name := range scene.prefabNames {
+		if _, err := scene.build(scene.prefabs[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, entity := range scene.entities {
+		if _, err := scene.build(entity); err != nil {
+			return nil, err
+		}
+	}
+	return scene, nil
+}
+
+func (s *Scene) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &SceneError{File: s.file, Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Scene) parseEntry(name string, node *yaml.Node) (*scenePrefab, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, s.errorf(node, "expected a mapping of extends and components")
+	}
+
+	prefab := &scenePrefab{
+		name:       name,
+		components: map[string]*yaml.Node{},
+		order:      []string{},
+	}
+
+	// prefabs extend another prefab, while entities are instantiated from one
+	extendsKey := "extends"
+	if name == "" {
+		extendsKey = "prefab"
+	}
+
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key, value := node.Content[index], node.Content[index+1]
+		switch key.Value {
+		case extendsKey:
+			if value.Kind != yaml.ScalarNode {
+				return nil, s.errorf(value, "expected the name of a prefab")
+			}
+			prefab.extends = value
+		case "components":
+			if value.Kind != yaml.MappingNode {
+				return nil, s.errorf(value, "expected a mapping of component names to fields")
+			}
+			for componentIdx := 0; componentIdx+1 < len(value.Content); componentIdx += 2 {
+				componentKey := value.Content[componentIdx]
+				if _, exists := ComponentTypeByName(componentKey.Value); !exists {
+					return nil, s.errorf(componentKey, "unknown component %v", componentKey.Value)
+				}
+				if _, exists := prefab.components[componentKey.Value]; exists {
+					return nil, s.errorf(componentKey, "duplicate component %v", componentKey.Value)
+				}
+				prefab.components[componentKey.Value] = value.Content[componentIdx+1]
+				prefab.order = append(prefab.order, componentKey.Value)
+			}
+		default:
+			return nil, s.errorf(key, "unknown key %v", key.Value)
+		}
+	}
+	return prefab, nil
+}
+
+// resolve returns the components of a prefab or entity, merged with those it inherits.
+func (s *Scene) resolve(prefab *scenePrefab, visited map[string]struct{}) ([]*sceneComponent, error) {
+	result := []*sceneComponent{}
+	byName := map[string]*sceneComponent{}
+
+	if prefab.extends != nil {
+		base, exists := s.prefabs[prefab.extends.Value]
+		if !exists {
+			return nil, s.errorf(prefab.extends, "unknown prefab %v", prefab.extends.Value)
+		}
+		if _, cycle := visited[base.name]; cycle {
+			return nil, s.errorf(prefab.extends, "prefab %v inherits from itself", base.name)
+		}
+		visited[base.name] = struct{}{}
+
+		inherited, err := s.resolve(base, visited)
+		if err != nil {
+			return nil, err
+		}
+		for _, component := range inherited {
+			name, _ := ComponentName(component.componentType)
+			byName[name] = component
+			result = append(result, component)
+		}
+	}
+
+	for _, name := range prefab.order {
+		component, exists := byName[name]
+		if !exists {
+			componentType, _ := ComponentTypeByName(name)
+			component = &sceneComponent{componentType: componentType, layers: []*yaml.Node{}}
+			byName[name] = component
+			result = append(result, component)
+		}
+		component.layers = append(component.layers, prefab.components[name])
+	}
+	return result, nil
+}
+
+// build creates the components of a prefab or entity.
+func (s *Scene) build(prefab *scenePrefab) ([]interface{}, error) {
+	visited := map[string]struct{}{}
+	if prefab.name != "" {
+		visited[prefab.name] = struct{}{}
+	}
+
+	components, err := s.resolve(prefab, visited)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(components))
+	for index, component := range components {
+		value := reflect.New(component.componentType)
+		for _, layer := range component.layers {
+			if err := s.decodeFields(layer, value.Elem()); err != nil {
+				return nil, err
+			}
+		}
+		result[index] = value.Interface()
+	}
+	return result, nil
+}
+
+// decodeFields sets each field within the mapping onto the component, leaving fields which
+// are not given untouched so that prefabs can override individual fields.
+func (s *Scene) decodeFields(node *yaml.Node, component reflect.Value) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return s.errorf(node, "expected a mapping of fields for %v", component.Type().Name())
+	}
+
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key, value := node.Content[index], node.Content[index+1]
+
+		field, exists := sceneField(component.Type(), key.Value)
+		if !exists {
+			return s.errorf(key, "unknown field %v on %v", key.Value, component.Type().Name())
+		}
+
+		target := reflect.New(field.Type)
+		if err := value.Decode(target.Interface()); err != nil {
+			return s.errorf(value, "invalid value for %v.%v: %v", component.Type().Name(), field.Name, err)
+		}
+		component.FieldByIndex(field.Index).Set(target.Elem())
+	}
+	return nil
+}
+
+// sceneField finds the exported field of a component matching the name, either by its json
+// tag or case-insensitively by its name.
+func sceneField(componentType reflect.Type, name string) (reflect.StructField, bool) {
+	for fieldIdx := 0; fieldIdx < componentType.NumField(); fieldIdx++ {
+		field := componentType.Field(fieldIdx)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Instantiate spawns every entity within the scene, returning their ids in the order they
+// where written.
+func (s *Scene) Instantiate(sim *Simulation) ([]EntityId, error) {
+	entities := make([][]interface{}, len(s.entities))
+	for index, entity := range s.entities {
+		components, err := s.build(entity)
+		if err != nil {
+			return nil, err
+		}
+		entities[index] = components
+	}
+
+	result := make([]EntityId, len(entities))
+	for index, components := range entities {
+		id, err := sim.TryAddEntity(components...)
+		if err != nil {
+			// leave the simulation as it was rather than with part of the scene
+			for _, spawned := range result[:index] {
+				sim.DeleteEntity(spawned)
+			}
+			return nil, fmt.Errorf("%v: failed to spawn entity %v: %w", s.file, index, err)
+		}
+		result[index] = id
+	}
+	return result, nil
+}
+
+// Spawn creates a new entity from the named prefab.
+func (s *Scene) Spawn(sim *Simulation, prefab string) (EntityId, error) {
+	components, err := s.PrefabComponents(prefab)
+	if err != nil {
+		return 0, err
+	}
+	id, err := sim.TryAddEntity(components...)
+	if err != nil {
+		return 0, fmt.Errorf("%v: failed to spawn prefab %v: %w", s.file, prefab, err)
+	}
+	return id, nil
+}
+
+// PrefabComponents returns a fresh copy of the components of the named prefab, which can be
+// used to spawn it through a CommandBuffer.
+func (s *Scene) PrefabComponents(prefab string) ([]interface{}, error) {
+	entry, exists := s.prefabs[prefab]
+	if !exists {
+		return nil, fmt.Errorf("%v: unknown prefab %v", s.file, prefab)
+	}
+	return s.build(entry)
+}
+
+// Prefabs returns the names of every prefab within the scene, in the order they where written.
+func (s *Scene) Prefabs() []string {
+	return append([]string{}, s.prefabNames...)
+}
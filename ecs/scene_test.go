@@ -0,0 +1,100 @@
+package ecs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSceneYAML = `
+prefabs:
+  Base:
+    components:
+      test.A: {A: 1.5}
+      test.B: {B: 10}
+  Derived:
+    extends: Base
+    components:
+      test.B: {B: 20}
+      test.C: {C: true}
+entities:
+  - prefab: Derived
+    components:
+      Name: {Name: derived}
+  - components:
+      test.A: {A: 3}
+`
+
+func TestSceneInstantiate(t *testing.T) {
+	scene, err := ParseScene("level.yaml", []byte(testSceneYAML))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Base", "Derived"}, scene.Prefabs())
+
+	sim := NewSimpleSimulation()
+	ids, err := scene.Instantiate(sim)
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	assert.ElementsMatch(t, []interface{}{
+		&componentA{A: 1.5},
+		&componentB{B: 20},
+		&componentC{C: true},
+		&NameComponent{Name: "derived"},
+	}, sim.Storage.Get(ids[0]), "prefabs should inherit and override components")
+	assert.ElementsMatch(t, []interface{}{&componentA{A: 3}}, sim.Storage.Get(ids[1]))
+
+	id, err := scene.Spawn(sim, "Base")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []interface{}{&componentA{A: 1.5}, &componentB{B: 10}}, sim.Storage.Get(id))
+
+	_, err = scene.Spawn(sim, "Missing")
+	assert.Error(t, err)
+}
+
+func TestSceneJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "level.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"prefabs": {"Base": {"components": {"test.A": {"A": 2}}}},
+		"entities": [{"prefab": "Base", "components": {"test.A": {"a": 4}}}]
+	}`), 0o644))
+
+	scene, err := LoadSceneFile(path)
+	assert.NoError(t, err)
+
+	sim := NewSimpleSimulation()
+	ids, err := scene.Instantiate(sim)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{&componentA{A: 4}}, sim.Storage.Get(ids[0]))
+}
+
+func TestSceneErrors(t *testing.T) {
+	cases := []struct {
+		document string
+		line     int
+		message  string
+	}{
+		{"entities:\n  - components:\n      Missing: {}\n", 3, "unknown component Missing"},
+		{"entities:\n  - components:\n      test.A: {Missing: 1}\n", 3, "unknown field Missing on componentA"},
+		{"entities:\n  - components:\n      test.A:\n        A: nope\n", 4, "invalid value for componentA.A"},
+		{"entities:\n  - prefab: Missing\n", 2, "unknown prefab Missing"},
+		{"prefabs:\n  A:\n    extends: B\n  B:\n    extends: A\n", 5, "inherits from itself"},
+		{"entities:\n  - unknown: true\n", 2, "unknown key unknown"},
+	}
+
+	for _, testCase := range cases {
+		_, err := ParseScene("level.yaml", []byte(testCase.document))
+
+		var sceneErr *SceneError
+		if assert.True(t, errors.As(err, &sceneErr), "expected a scene error for %q, got %v", testCase.document, err) {
+			assert.Equal(t, "level.yaml", sceneErr.File)
+			assert.Equal(t, testCase.line, sceneErr.Line, testCase.message)
+			assert.Contains(t, sceneErr.Message, testCase.message)
+		}
+	}
+
+	_, err := ParseScene("level.yaml", []byte("entities: [\n"))
+	assert.ErrorContains(t, err, "level.yaml")
+}
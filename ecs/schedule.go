@@ -0,0 +1,173 @@
+package ecs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Stage groups systems which run at the same point within each update. Systems within an
+// earlier stage always run before systems within a later stage.
+type Stage string
+
+const (
+	StagePreUpdate  Stage = "PreUpdate"
+	StageUpdate     Stage = "Update"
+	StagePostUpdate Stage = "PostUpdate"
+	StageRender     Stage = "Render"
+)
+
+// DefaultStages is the default order of stages used by executors.
+var DefaultStages = []Stage{StagePreUpdate, StageUpdate, StagePostUpdate, StageRender}
+
+// SystemConfig describes where a system is placed within an executor's schedule.
+type SystemConfig struct {
+	// Label names the system so that other systems can order themselves around it. Multiple
+	// systems may share a label, in which case constraints apply to all of them.
+	Label string
+	// Stage the system runs within, defaulting to StageUpdate.
+	Stage Stage
+	// Before lists labels of systems which this system must run before.
+	Before []string
+	// After lists labels of systems which this system must run after.
+	After []string
+}
+
+// scheduledSystem is a system along with its position within an executor's schedule.
+type scheduledSystem struct {
+	system System
+	config SystemConfig
+	// order is the position the system was added to the executor in
+	order int
+	// dependencies are the systems which must run before this one due to ordering constraints
+	dependencies []*scheduledSystem
+	// lastRun is the change tick the system was last updated at
+	lastRun uint64
+	// frame is the copy of the simulation frame passed to the system, holding its own ticks
+	frame SimulationFrame
+}
+
+// update runs the system with a copy of the frame describing when it last ran, so that its
+// queries only see the changes made since then.
+func (s *scheduledSystem) update(frame *SimulationFrame, tick uint64) {
+	s.frame = *frame
+	s.frame.LastRun = s.lastRun
+	s.frame.ThisRun = tick
+	s.system.Update(&s.frame)
+	s.lastRun = tick
+}
+
+func (s *scheduledSystem) stage() Stage {
+	if s.config.Stage == "" {
+		return StageUpdate
+	}
+	return s.config.Stage
+}
+
+func (s *scheduledSystem) name() string {
+	if s.config.Label != "" {
+		return s.config.Label
+	}
+	return reflect.TypeOf(s.system).String()
+}
+
+// sortSystems orders systems by stage, then by their before / after constraints, and
+// finally by the order they where added in. An error is returned if a system references an
+// unknown stage or label, or if the constraints contain a cycle.
+func sortSystems(systems []*scheduledSystem, stages []Stage) ([]*scheduledSystem, error) {
+	stageIndex := make(map[Stage]int, len(stages))
+	for index, stage := range stages {
+		stageIndex[stage] = index
+	}
+
+	labels := map[string][]int{}
+	for index, system := range systems {
+		if _, exists := stageIndex[system.stage()]; !exists {
+			return nil, fmt.Errorf("system %v is in unknown stage %v", system.name(), system.stage())
+		}
+		if system.config.Label != "" {
+			labels[system.config.Label] = append(labels[system.config.Label], index)
+		}
+		system.dependencies = []*scheduledSystem{}
+	}
+
+	successors := make([][]int, len(systems))
+	indegree := make([]int, len(systems))
+	addEdge := func(from int, to int) error {
+		if stageIndex[systems[from].stage()] > stageIndex[systems[to].stage()] {
+			return fmt.Errorf(
+				"system %v in stage %v cannot run before system %v in earlier stage %v",
+				systems[from].name(), systems[from].stage(), systems[to].name(), systems[to].stage(),
+			)
+		}
+		successors[from] = append(successors[from], to)
+		indegree[to] += 1
+		systems[to].dependencies = append(systems[to].dependencies, systems[from])
+		return nil
+	}
+
+	for index, system := range systems {
+		for _, label := range system.config.Before {
+			targets, exists := labels[label]
+			if !exists {
+				return nil, fmt.Errorf("system %v must run before unknown label %v", system.name(), label)
+			}
+			for _, target := range targets {
+				if err := addEdge(index, target); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, label := range system.config.After {
+			targets, exists := labels[label]
+			if !exists {
+				return nil, fmt.Errorf("system %v must run after unknown label %v", system.name(), label)
+			}
+			for _, target := range targets {
+				if err := addEdge(target, index); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// kahn's algorithm, always picking the available system with the earliest stage and
+	// add order so that unconstrained systems keep their existing order
+	less := func(a int, b int) bool {
+		stageA, stageB := stageIndex[systems[a].stage()], stageIndex[systems[b].stage()]
+		if stageA != stageB {
+			return stageA < stageB
+		}
+		return systems[a].order < systems[b].order
+	}
+
+	result := make([]*scheduledSystem, 0, len(systems))
+	done := make([]bool, len(systems))
+	for len(result) < len(systems) {
+		next := -1
+		for index := range systems {
+			if !done[index] && indegree[index] == 0 && (next == -1 || less(index, next)) {
+				next = index
+			}
+		}
+
+		if next == -1 {
+			remaining := []string{}
+			for index, system := range systems {
+				if !done[index] {
+					remaining = append(remaining, system.name())
+				}
+			}
+			return nil, fmt.Errorf("system ordering contains a cycle between %v", strings.Join(remaining, ", "))
+		}
+
+		done[next] = true
+		result = append(result, systems[next])
+		for _, successor := range successors[next] {
+			indegree[successor] -= 1
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// namedSystem records its name within a shared log when updated.
+type namedSystem struct {
+	name string
+	log  *[]string
+}
+
+func (n *namedSystem) Update(frame *SimulationFrame) {
+	*n.log = append(*n.log, n.name)
+}
+
+func (n *namedSystem) Render(frame *SimulationFrame) {}
+
+func TestSequentialExecutorStagesAndConstraints(t *testing.T) {
+	log := []string{}
+	executor := NewSequentialSystemExecutor()
+	executor.AddWithConfig(&namedSystem{name: "render", log: &log}, SystemConfig{Stage: StageRender})
+	executor.AddWithConfig(&namedSystem{name: "physics", log: &log}, SystemConfig{Label: "physics", After: []string{"input"}})
+	executor.Add(&namedSystem{name: "gameplay", log: &log})
+	executor.AddWithConfig(&namedSystem{name: "input", log: &log}, SystemConfig{Label: "input"})
+	executor.AddWithConfig(&namedSystem{name: "cleanup", log: &log}, SystemConfig{Stage: StagePostUpdate})
+	executor.AddWithConfig(&namedSystem{name: "time", log: &log}, SystemConfig{Stage: StagePreUpdate})
+	executor.AddWithConfig(&namedSystem{name: "ai", log: &log}, SystemConfig{Before: []string{"physics"}})
+
+	sim := NewSimulation(NewEntitySimpleStorage(), executor)
+	assert.NoError(t, sim.Setup())
+	sim.Update()
+
+	assert.Equal(t, []string{"time", "gameplay", "input", "ai", "physics", "cleanup", "render"}, log)
+	assert.Len(t, executor.All(), 7)
+}
+
+type configurableExecutor interface {
+	SystemExecutor
+	AddWithConfig(System, SystemConfig)
+}
+
+func TestExecutorScheduleErrors(t *testing.T) {
+	executors := map[string]func() configurableExecutor{
+		"sequential": func() configurableExecutor { return NewSequentialSystemExecutor() },
+		"parallel":   func() configurableExecutor { return NewParallelSystemExecutor() },
+	}
+
+	for name, newExecutor := range executors {
+		log := []string{}
+
+		cycle := newExecutor()
+		cycle.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Label: "a", After: []string{"b"}})
+		cycle.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Label: "b", After: []string{"a"}})
+		assert.ErrorContains(t, NewSimulation(NewEntitySimpleStorage(), cycle).Setup(), "cycle", name)
+
+		unknown := newExecutor()
+		unknown.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Label: "a", Before: []string{"missing"}})
+		assert.ErrorContains(t, NewSimulation(NewEntitySimpleStorage(), unknown).Setup(), "unknown label", name)
+
+		stage := newExecutor()
+		stage.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Stage: "Missing"})
+		assert.ErrorContains(t, NewSimulation(NewEntitySimpleStorage(), stage).Setup(), "unknown stage", name)
+
+		crossStage := newExecutor()
+		crossStage.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Label: "early", Stage: StagePreUpdate})
+		crossStage.AddWithConfig(&namedSystem{log: &log}, SystemConfig{Stage: StagePostUpdate, Before: []string{"early"}})
+		assert.ErrorContains(t, NewSimulation(NewEntitySimpleStorage(), crossStage).Setup(), "earlier stage", name)
+	}
+}
+
+func TestParallelExecutorStagesAndConstraints(t *testing.T) {
+	log := []string{}
+	first := &rendezvousSystem{}
+	second := &rendezvousSystem{}
+	third := &rendezvousSystem{}
+	render := &namedSystem{log: &log}
+
+	executor := NewParallelSystemExecutor()
+	executor.AddWithConfig(render, SystemConfig{Stage: StageRender})
+	executor.AddWithConfig(third, SystemConfig{After: []string{"second"}})
+	executor.AddWithConfig(second, SystemConfig{Label: "second"})
+	executor.AddWithConfig(first, SystemConfig{Stage: StagePreUpdate})
+	assert.NoError(t, executor.schedule())
+
+	// none of the systems access conflicting components, so only stages and constraints
+	// separate them into batches
+	assert.Equal(t, [][]System{{first}, {second}, {third}, {render}}, batchedSystems(executor))
+	assert.Equal(t, []System{first, second, third, render}, executor.All())
+}
+
+func TestExecutorsCopyDefaultStages(t *testing.T) {
+	sequential := NewSequentialSystemExecutor()
+	sequential.Stages[0] = "custom"
+	parallel := NewParallelSystemExecutor()
+	parallel.Stages[0] = "custom"
+
+	assert.Equal(t, StagePreUpdate, DefaultStages[0], "editing an executor's stages should not change the defaults")
+	assert.Equal(t, StagePreUpdate, NewSequentialSystemExecutor().Stages[0])
+}
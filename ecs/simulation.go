@@ -1,98 +1,463 @@
 package ecs
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"reflect"
+	"sync"
 	"time"
 )
 
 type SimulationFrame struct {
-	Sim           *Simulation
-	Delta         float64
+	Sim *Simulation
+	// Delta is the duration of a single update in seconds.
+	Delta float64
+	// Alpha is how far (from 0 to 1) the simulation clock has progressed towards the next
+	// update, used by Render to interpolate between the previous and current update.
+	Alpha         float64
 	LastFrameTime uint32
-	Data          map[string]interface{}
+	// Deprecated: Data is untyped and has no lifetime, use resources (InsertResource and
+	// Resource) or events (SendEvent and ReadEvents) instead.
+	Data map[string]interface{}
+
+	// LastRun is the change tick at which the currently running system was last updated, zero
+	// if it has never run. Queries executed with ExecuteFrame only match added and changed
+	// components newer than this tick.
+	LastRun uint64
+	// ThisRun is the change tick of the current update of the running system.
+	ThisRun uint64
+
+	// Commands records structural changes made by systems, which are applied at the
+	// simulation's sync point instead of while queries are being iterated.
+	Commands *CommandBuffer
 }
 
+// Deprecated: use Resource or ReadEvents instead.
 func WithFrameData[T any](frame *SimulationFrame, name string) T {
 	return frame.Data[name].(T)
 }
 
+// Deprecated: use InsertResource or SendEvent instead.
 func (s *SimulationFrame) Set(key string, value interface{}) {
 	s.Data[key] = value
 }
 
+// AfterSystemUpdate must be called by executors once a system has been updated, applying
+// any recorded commands if the simulation syncs after each system.
+func (s *SimulationFrame) AfterSystemUpdate() {
+	if s.Sim.SyncPoint == SyncAfterSystem {
+		s.Commands.Flush()
+	}
+}
+
+// entitySlot tracks the current generation of an entity index and whether it is in use.
+type entitySlot struct {
+	generation uint32
+	alive      bool
+}
+
+// DefaultFixedTimestep is the timestep updates run at when a simulation does not set one.
+const DefaultFixedTimestep = time.Second / 60
+
 type Simulation struct {
 	Storage  EntityStorage
 	Executor SystemExecutor
 	Frame    *SimulationFrame
 
-	id EntityId
+	// SyncPoint controls when commands recorded on the frame's CommandBuffer are applied.
+	SyncPoint SyncPoint
+
+	// Clock is used by Step to measure how much time has passed.
+	Clock Clock
+	// FixedTimestep is the amount of simulated time covered by each update. Zero uses
+	// DefaultFixedTimestep, while negative timesteps are rejected by Setup.
+	FixedTimestep time.Duration
+	// MaxUpdatesPerStep caps the number of updates a single Step may run, preventing the
+	// simulation from falling further and further behind when updates are slower than the
+	// timestep. Time beyond the cap is dropped. Zero disables the cap.
+	MaxUpdatesPerStep int
+
+	accumulator time.Duration
+	lastStep    time.Time
+
+	removals  *removalEvents
+	eventLock sync.RWMutex
+	events    map[reflect.Type]eventSwapper
+
+	resourceLock sync.RWMutex
+	resources    map[reflect.Type]interface{}
+
+	// slotLock guards slots and free, as ids may be reserved by concurrently running systems
+	slotLock sync.RWMutex
+	slots    []entitySlot
+	free     []uint32
 }
 
 func NewSimulation(storage EntityStorage, executor SystemExecutor) *Simulation {
 	sim := &Simulation{
-		Storage:  storage,
-		Executor: executor,
-		id:       1,
+		Storage:           storage,
+		Executor:          executor,
+		Clock:             SystemClock,
+		FixedTimestep:     DefaultFixedTimestep,
+		MaxUpdatesPerStep: 5,
+		// the first slot is never handed out so that a zero EntityId is never valid
+		slots:    []entitySlot{{}},
+		free:     []uint32{},
+		removals: newRemovalEvents(),
+		events:   map[reflect.Type]eventSwapper{},
+		// resources are stored as pointers so that systems can mutate them in place
+		resources: map[reflect.Type]interface{}{},
 	}
 	sim.Frame = &SimulationFrame{
 		Sim:           sim,
 		Delta:         0,
+		Alpha:         0,
 		LastFrameTime: 0,
 		Data:          map[string]interface{}{},
+		Commands:      NewCommandBuffer(sim),
 	}
 	return sim
 }
 
 // NewSimpleSimulation creates a new simulation with simple defaults
 func NewSimpleSimulation() *Simulation {
-	return &Simulation{
-		Storage:  NewEntitySimpleStorage(),
-		Executor: NewSequentialSystemExecutor(),
+	return NewSimulation(NewEntitySimpleStorage(), NewSequentialSystemExecutor())
+}
+
+// IsAlive returns whether the given entity id refers to an entity which has not been
+// deleted. Ids whose slot has since been recycled for a new entity are not alive.
+func (s *Simulation) IsAlive(id EntityId) bool {
+	s.slotLock.RLock()
+	defer s.slotLock.RUnlock()
+
+	index := id.Index()
+	if index >= uint32(len(s.slots)) {
+		return false
+	}
+
+	slot := s.slots[index]
+	return slot.alive && slot.generation == id.Generation()
+}
+
+// checkEntity returns an error wrapping ErrStaleEntity if the entity has been deleted, or
+// ErrEntityNotFound if the id has never referred to an entity.
+func (s *Simulation) checkEntity(id EntityId) error {
+	s.slotLock.RLock()
+	defer s.slotLock.RUnlock()
+
+	index := id.Index()
+	if index == 0 || index >= uint32(len(s.slots)) {
+		return fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	slot := s.slots[index]
+	if slot.alive && slot.generation == id.Generation() {
+		return nil
 	}
+	if id.Generation() < slot.generation {
+		return fmt.Errorf("%w: %v", ErrStaleEntity, id)
+	}
+	return fmt.Errorf("%w: %v", ErrEntityNotFound, id)
 }
 
+// AddEntity creates a new entity with the given components, which must be of registered
+// component types. Components passed by value are copied into a pointer. It panics if a
+// component is invalid, see TryAddEntity.
 func (s *Simulation) AddEntity(components ...interface{}) EntityId {
-	id := s.id
-	s.id += 1
-	s.Storage.Add(id, components...)
+	id, err := s.TryAddEntity(components...)
+	if err != nil {
+		log.Panicf("failed to add entity: %v", err)
+	}
 	return id
 }
 
+// TryAddEntity creates a new entity with the given components, returning an error wrapping
+// ErrInvalidComponentType if a component is invalid.
+func (s *Simulation) TryAddEntity(components ...interface{}) (EntityId, error) {
+	id := s.reserveEntity()
+	if err := s.spawnReserved(id, components...); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// reserveEntity allocates an entity id without adding the entity to storage. The entity is
+// not alive until it is spawned with spawnReserved.
+func (s *Simulation) reserveEntity() EntityId {
+	s.slotLock.Lock()
+	defer s.slotLock.Unlock()
+
+	var index uint32
+	if len(s.free) > 0 {
+		index = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+	} else {
+		index = uint32(len(s.slots))
+		s.slots = append(s.slots, entitySlot{})
+	}
+
+	return NewEntityId(index, s.slots[index].generation)
+}
+
+// spawnReserved adds a reserved entity to storage, releasing its id if the components are
+// invalid.
+func (s *Simulation) spawnReserved(id EntityId, components ...interface{}) error {
+	// components are resolved up front so that invalid components release the id
+	resolved := make([]interface{}, len(components))
+	infos := make([]*ComponentInfo, len(components))
+	for index, component := range components {
+		pointer, info, err := resolveComponent(component)
+		if err != nil {
+			s.releaseEntity(id)
+			return err
+		}
+		resolved[index] = pointer
+		infos[index] = info
+	}
+
+	if err := s.Storage.Add(id, resolved...); err != nil {
+		s.releaseEntity(id)
+		return err
+	}
+
+	s.slotLock.Lock()
+	s.slots[id.Index()].alive = true
+	s.slotLock.Unlock()
+
+	for _, info := range infos {
+		if info.Hooks.OnAdd != nil {
+			// storages may copy components, so hooks are given the stored component
+			info.Hooks.OnAdd(s, id, s.Storage.GetComponent(id, info.Id))
+		}
+	}
+	return nil
+}
+
+// releaseEntity recycles the slot of an entity id, bumping its generation so that the id is
+// no longer alive.
+func (s *Simulation) releaseEntity(id EntityId) {
+	s.slotLock.Lock()
+	defer s.slotLock.Unlock()
+
+	slot := &s.slots[id.Index()]
+	slot.alive = false
+	slot.generation += 1
+	s.free = append(s.free, id.Index())
+}
+
+// DeleteEntity removes the entity and its components, recycling its slot for future
+// entities. Deleting a stale id is a noop. The entity and each of its components are
+// reported to DespawnedEntities and RemovedComponents readers. The entity is removed from
+// its parent, and its children become roots of the hierarchy (use DeleteEntityRecursive to
+// delete them as well). The OnRemove hook of each component is run before it is deleted.
 func (s *Simulation) DeleteEntity(id EntityId) {
+	// deleting a stale id is allowed, see TryDeleteEntity
+	s.TryDeleteEntity(id)
+}
+
+// TryDeleteEntity deletes an entity (see DeleteEntity), returning an error wrapping
+// ErrStaleEntity or ErrEntityNotFound if the entity is not alive.
+func (s *Simulation) TryDeleteEntity(id EntityId) error {
+	if err := s.checkEntity(id); err != nil {
+		return err
+	}
+
+	s.detachFromParent(id)
+	s.orphanChildren(id)
+
+	for _, component := range s.Storage.Get(id) {
+		componentType := reflect.TypeOf(component)
+		if info, exists := lookupComponentType(componentType); exists && info.Hooks.OnRemove != nil {
+			info.Hooks.OnRemove(s, id, component)
+		}
+		s.removals.removed(id, componentType, component)
+	}
 	s.Storage.Delete(id)
+	s.removals.despawned.push(id)
+	s.releaseEntity(id)
+	return nil
 }
 
+// GetComponent copies the entity's component into the given pointer, returning false if the
+// entity is not alive or does not have the component, see TryGetComponent.
 func (s *Simulation) GetComponent(id EntityId, component interface{}) bool {
-	result := s.Storage.GetComponent(id, reflect.TypeOf(component))
-	if result == nil {
-		return false
+	return s.TryGetComponent(id, component) == nil
+}
+
+// TryGetComponent copies the entity's component into the given pointer, returning an error
+// wrapping ErrInvalidComponentType, ErrStaleEntity, ErrEntityNotFound, or
+// ErrComponentNotFound if it could not be read.
+func (s *Simulation) TryGetComponent(id EntityId, component interface{}) error {
+	componentType := reflect.TypeOf(component)
+	if componentType == nil || componentType.Kind() != reflect.Pointer || reflect.ValueOf(component).IsNil() {
+		return fmt.Errorf("%w: component %v must be a non-nil pointer to read into", ErrInvalidComponentType, componentType)
+	}
+
+	info, exists := lookupComponentType(componentType)
+	if !exists {
+		return fmt.Errorf("%w: component type %v is not registered", ErrInvalidComponentType, componentType.Elem())
+	}
+	if err := s.checkEntity(id); err != nil {
+		return err
+	}
+
+	result, err := s.Storage.TryGetComponent(id, info.Id)
+	if err != nil {
+		return err
 	}
 
 	reflect.ValueOf(component).Elem().Set(reflect.ValueOf(result).Elem())
-	return true
+	return nil
 }
 
+// RemoveComponent removes the entity's component of the same type as the given component,
+// which may be passed by value or pointer. Removing a missing component is a noop, see
+// TryRemoveComponent.
 func (s *Simulation) RemoveComponent(id EntityId, component interface{}) {
+	s.TryRemoveComponent(id, component)
+}
+
+// TryRemoveComponent removes a component from an entity (see RemoveComponent), returning an
+// error wrapping ErrInvalidComponentType, ErrStaleEntity, ErrEntityNotFound, or
+// ErrComponentNotFound if nothing was removed.
+func (s *Simulation) TryRemoveComponent(id EntityId, component interface{}) error {
 	componentType := reflect.TypeOf(component)
-	if componentType.Kind() == reflect.Struct {
+	if componentType != nil && componentType.Kind() == reflect.Struct {
 		componentType = reflect.PointerTo(componentType)
-	} else if componentType.Kind() != reflect.Ptr || componentType.Elem().Kind() != reflect.Struct {
-		return
+	} else if componentType == nil || componentType.Kind() != reflect.Pointer || componentType.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: component %v must be a struct or a pointer to a struct", ErrInvalidComponentType, componentType)
+	}
+
+	info, exists := lookupComponentType(componentType)
+	if !exists {
+		return fmt.Errorf("%w: component type %v is not registered", ErrInvalidComponentType, componentType.Elem())
+	}
+	return s.removeComponent(id, info)
+}
+
+// removeComponent removes a component of a resolved type, running its hooks and reporting
+// it to RemovedComponents readers.
+func (s *Simulation) removeComponent(id EntityId, info *ComponentInfo) error {
+	if err := s.checkEntity(id); err != nil {
+		return err
 	}
 
-	s.Storage.RemoveComponent(id, componentType)
+	removed, err := s.Storage.TryGetComponent(id, info.Id)
+	if err != nil {
+		return err
+	}
+	if info.Hooks.OnRemove != nil {
+		info.Hooks.OnRemove(s, id, removed)
+	}
+	s.removals.removed(id, info.Type, removed)
+	s.Storage.RemoveComponent(id, info.Id)
+	return nil
 }
 
+// AddComponent adds a component to an entity, replacing any existing component of the same
+// type. Components passed by value are copied into a pointer. Adding a component to an
+// entity which is not alive is ignored, however it panics if the component is not of a
+// registered component type, see TryAddComponent.
 func (s *Simulation) AddComponent(id EntityId, component interface{}) {
-	s.Storage.AddComponent(id, component)
+	err := s.TryAddComponent(id, component)
+	if errors.Is(err, ErrInvalidComponentType) {
+		log.Panicf("failed to add component to entity %v: %v", id, err)
+	}
+}
+
+// TryAddComponent adds a component to an entity (see AddComponent), returning an error
+// wrapping ErrStaleEntity or ErrEntityNotFound if the entity is not alive, or
+// ErrInvalidComponentType if the component is not of a registered component type.
+func (s *Simulation) TryAddComponent(id EntityId, component interface{}) error {
+	if err := s.checkEntity(id); err != nil {
+		return err
+	}
+
+	component, info, err := resolveComponent(component)
+	if err != nil {
+		return err
+	}
+	return s.insertComponent(id, info, component)
+}
+
+// insertComponent adds or replaces a component of a resolved type, running its hooks if it
+// was newly added.
+func (s *Simulation) insertComponent(id EntityId, info *ComponentInfo, component interface{}) error {
+	added, err := s.Storage.SetComponent(id, info.Id, component)
+	if err != nil {
+		return err
+	}
+	if added && info.Hooks.OnAdd != nil {
+		info.Hooks.OnAdd(s, id, s.Storage.GetComponent(id, info.Id))
+	}
+	return nil
+}
+
+// MarkChanged marks the entity's component of the given type as changed, which is required
+// for `ecs:"changed"` query fields to see components mutated through a pointer.
+func (s *Simulation) MarkChanged(id EntityId, component interface{}) {
+	if !s.IsAlive(id) {
+		return
+	}
+	s.Storage.MarkChanged(id, componentIdOf(normalizeComponentType(reflect.TypeOf(component))))
 }
 
+// Setup prepares the executor's systems, returning an error if FixedTimestep is negative.
 func (s *Simulation) Setup() error {
+	if s.FixedTimestep < 0 {
+		return fmt.Errorf("fixed timestep must not be negative, got %v", s.FixedTimestep)
+	}
 	return s.Executor.Setup(s)
 }
 
+// fixedTimestep returns the timestep updates run at, using DefaultFixedTimestep if none is set.
+func (s *Simulation) fixedTimestep() time.Duration {
+	if s.FixedTimestep <= 0 {
+		return DefaultFixedTimestep
+	}
+	return s.FixedTimestep
+}
+
+// Step advances the simulation by the time that has passed on its clock since the last
+// step, running zero or more fixed updates and computing the interpolation alpha for Render.
+// It returns the number of updates that where run. Step is designed to be called once per
+// rendered frame.
+func (s *Simulation) Step() int {
+	timestep := s.fixedTimestep()
+
+	now := s.Clock.Now()
+	if s.lastStep.IsZero() {
+		s.lastStep = now
+	}
+	s.accumulator += now.Sub(s.lastStep)
+	s.lastStep = now
+
+	updates := 0
+	for s.accumulator >= timestep {
+		if s.MaxUpdatesPerStep > 0 && updates >= s.MaxUpdatesPerStep {
+			s.accumulator %= timestep
+			break
+		}
+
+		s.Update()
+		s.accumulator -= timestep
+		updates += 1
+	}
+
+	s.Frame.Alpha = float64(s.accumulator) / float64(timestep)
+	return updates
+}
+
+// Update runs a single fixed update of every system, applying any outstanding commands once
+// all systems have been updated.
 func (s *Simulation) Update() {
+	s.Frame.Delta = s.fixedTimestep().Seconds()
 	s.Executor.Update(s.Frame)
+	// changes made after the last system ran must be newer than its tick to be seen next update
+	s.Storage.AdvanceChangeTick()
+	s.Frame.Commands.Flush()
+	s.swapEvents()
 }
 
 func (s *Simulation) Render() {
@@ -2,6 +2,7 @@ package ecs
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,24 +27,114 @@ func TestSimulationEntities(t *testing.T) {
 	assert.Equal(t, true, simulation.GetComponent(id, &test), "get component should be ok")
 	assert.Equal(t, int32(5), test.a, "read component field 'a' should match")
 
-	// should be a noop
-	simulation.AddComponent(id, otherComponent{
+	// components passed by value are copied into a pointer
+	assert.NoError(t, simulation.TryAddComponent(id, otherComponent{
 		x: 55,
-	})
+	}))
 
 	var other otherComponent
 	assert.Equal(t, true, simulation.GetComponent(id, &other), "get component should be ok")
-	assert.Equal(t, 15, other.x, "read component field 'x' should match")
+	assert.Equal(t, 55, other.x, "value component should replace the existing component")
+	assert.Len(t, NewQuery[struct{ Other *otherComponent }]().Execute(simulation).ToList(), 1, "value component should be queryable")
 
 	simulation.RemoveComponent(id, otherComponent{})
 	assert.Equal(t, false, simulation.GetComponent(id, &other), "get component should fail")
 
-	simulation.AddComponent(id, &otherComponent{
-		x: 55,
-	})
+	assert.NoError(t, simulation.TryAddComponent(id, &otherComponent{
+		x: 65,
+	}))
 	assert.Equal(t, true, simulation.GetComponent(id, &other), "get component should be ok ")
-	assert.Equal(t, 55, other.x, "read component field 'x' should match")
+	assert.Equal(t, 65, other.x, "read component field 'x' should match")
+
+	assert.Error(t, simulation.TryAddComponent(id, 5), "non-struct components should be rejected")
 
 	simulation.DeleteEntity(id)
 	assert.Equal(t, false, simulation.GetComponent(id, &test), "get component should fail")
 }
+
+func TestSimulationEntityRecycling(t *testing.T) {
+	simulation := NewSimpleSimulation()
+	first := simulation.AddEntity(&testComponent{a: 1})
+	assert.True(t, simulation.IsAlive(first), "new entity should be alive")
+	assert.False(t, simulation.IsAlive(0), "zero entity id should never be alive")
+
+	simulation.DeleteEntity(first)
+	assert.False(t, simulation.IsAlive(first), "deleted entity should not be alive")
+
+	second := simulation.AddEntity(&testComponent{a: 2})
+	assert.Equal(t, first.Index(), second.Index(), "deleted entity slot should be recycled")
+	assert.Equal(t, first.Generation()+1, second.Generation(), "recycled slot should bump its generation")
+	assert.NotEqual(t, first, second, "recycled entity id should not match the stale id")
+	assert.False(t, simulation.IsAlive(first), "stale entity id should not be alive")
+	assert.True(t, simulation.IsAlive(second), "recycled entity should be alive")
+
+	// stale handles must not read or mutate the recycled entity
+	var test testComponent
+	assert.False(t, simulation.GetComponent(first, &test), "get component with a stale id should fail")
+	simulation.RemoveComponent(first, testComponent{})
+	simulation.DeleteEntity(first)
+	assert.True(t, simulation.GetComponent(second, &test), "get component should be ok")
+	assert.Equal(t, int32(2), test.a, "read component field 'a' should match")
+
+	query := NewQuery[struct {
+		Id   EntityId
+		Test *testComponent
+	}]()
+	assert.Nil(t, query.Get(simulation, first), "query get with a stale id should fail")
+	item := query.Get(simulation, second)
+	assert.Equal(t, second, item.Id)
+	assert.Equal(t, int32(2), item.Test.a)
+}
+
+// deltaSystem records the delta of every update it observes.
+type deltaSystem struct {
+	deltas []float64
+}
+
+func (d *deltaSystem) Update(frame *SimulationFrame) {
+	d.deltas = append(d.deltas, frame.Delta)
+}
+
+func (d *deltaSystem) Render(frame *SimulationFrame) {}
+
+func TestSimulationFixedTimestep(t *testing.T) {
+	executor := NewSequentialSystemExecutor()
+	system := &deltaSystem{}
+	executor.Add(system)
+
+	clock := NewManualClock(time.Unix(0, 0))
+	simulation := NewSimulation(NewEntitySimpleStorage(), executor)
+	simulation.Clock = clock
+	simulation.FixedTimestep = 10 * time.Millisecond
+	simulation.MaxUpdatesPerStep = 4
+	assert.NoError(t, simulation.Setup())
+
+	assert.Equal(t, 0, simulation.Step(), "first step should only start the clock")
+
+	clock.Advance(5 * time.Millisecond)
+	assert.Equal(t, 0, simulation.Step(), "step shorter than the timestep should not update")
+	assert.InDelta(t, 0.5, simulation.Frame.Alpha, 0.0001)
+
+	clock.Advance(20 * time.Millisecond)
+	assert.Equal(t, 2, simulation.Step(), "accumulated time should run multiple updates")
+	assert.InDelta(t, 0.5, simulation.Frame.Alpha, 0.0001)
+	assert.Equal(t, []float64{0.01, 0.01}, system.deltas, "updates should observe the fixed delta")
+
+	// a long stall is capped, dropping the remaining whole updates but keeping the remainder
+	clock.Advance(time.Second)
+	assert.Equal(t, 4, simulation.Step(), "updates should be capped per step")
+	assert.InDelta(t, 0.5, simulation.Frame.Alpha, 0.0001)
+
+	clock.Advance(5 * time.Millisecond)
+	assert.Equal(t, 1, simulation.Step(), "simulation should recover after being capped")
+	assert.InDelta(t, 0, simulation.Frame.Alpha, 0.0001)
+
+	simulation.FixedTimestep = 0
+	clock.Advance(DefaultFixedTimestep)
+	assert.Equal(t, 1, simulation.Step(), "zero should use the default timestep")
+	assert.Len(t, system.deltas, 8)
+	assert.InDelta(t, DefaultFixedTimestep.Seconds(), system.deltas[7], 0.0001)
+
+	simulation.FixedTimestep = -time.Millisecond
+	assert.Error(t, simulation.Setup(), "negative timesteps should be rejected")
+}
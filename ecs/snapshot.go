@@ -0,0 +1,314 @@
+package ecs
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// snapshotVersion is incremented whenever the snapshot format changes incompatibly.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int `json:"version"`
+	// Types is the table of registered component and relation names referenced by index
+	Types    []string         `json:"types"`
+	Slots    []snapshotSlot   `json:"slots"`
+	Free     []uint32         `json:"free"`
+	Entities []snapshotEntity `json:"entities"`
+}
+
+type snapshotSlot struct {
+	Generation uint32 `json:"generation"`
+	Alive      bool   `json:"alive"`
+}
+
+type snapshotEntity struct {
+	Id         EntityId            `json:"id"`
+	Components []snapshotComponent `json:"components"`
+	Relations  []snapshotRelation  `json:"relations,omitempty"`
+}
+
+type snapshotComponent struct {
+	Type int             `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type snapshotRelation struct {
+	Type   int      `json:"type"`
+	Target EntityId `json:"target"`
+}
+
+// snapshotTypes builds the type table of a snapshot, assigning each registered type an index
+// the first time it is seen.
+type snapshotTypes struct {
+	names   []string
+	indexes map[reflect.Type]int
+}
+
+func (t *snapshotTypes) index(componentType reflect.Type) (int, error) {
+	if index, exists := t.indexes[componentType]; exists {
+		return index, nil
+	}
+
+	name, exists := ComponentName(componentType)
+	if !exists {
+		return 0, fmt.Errorf("type %v is not registered, see RegisterComponent", componentType)
+	}
+
+	index := len(t.names)
+	t.names = append(t.names, name)
+	t.indexes[componentType] = index
+	return index, nil
+}
+
+// component returns the index of a component type, checking that every field of the
+// component will be saved the first time it is seen.
+func (t *snapshotTypes) component(componentType reflect.Type) (int, error) {
+	if _, exists := t.indexes[componentType]; !exists {
+		if err := checkExportedFields(componentType, map[reflect.Type]struct{}{}); err != nil {
+			return 0, err
+		}
+	}
+	return t.index(componentType)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// checkExportedFields returns an error if a type has unexported fields, which would be
+// silently dropped by JSON. Types which encode themselves are assumed to save everything.
+func checkExportedFields(valueType reflect.Type, seen map[reflect.Type]struct{}) error {
+	if _, exists := seen[valueType]; exists {
+		return nil
+	}
+	seen[valueType] = struct{}{}
+
+	for _, marshaler := range []reflect.Type{jsonMarshalerType, textMarshalerType} {
+		if valueType.Implements(marshaler) || reflect.PointerTo(valueType).Implements(marshaler) {
+			return nil
+		}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return checkExportedFields(valueType.Elem(), seen)
+	case reflect.Struct:
+		for fieldIdx := 0; fieldIdx < valueType.NumField(); fieldIdx++ {
+			field := valueType.Field(fieldIdx)
+			if field.Tag.Get("json") == "-" {
+				continue
+			}
+			// the exported fields of embedded structs are encoded even if the struct is not
+			if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+				return fmt.Errorf("field %v of %v is unexported and would not be saved", field.Name, valueType)
+			}
+			if err := checkExportedFields(field.Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot writes every entity, its components, and its relations to the writer. Component
+// and relation types must be registered with RegisterComponent, and components are encoded
+// as JSON, so an error is returned for components with unexported fields which would not be
+// saved. Entity ids (including the generations of deleted entities) are preserved exactly by
+// Restore. Resources and events are not saved, and commands must be flushed first as ids
+// reserved by pending spawns can not be saved.
+func (s *Simulation) Snapshot(writer io.Writer) error {
+	s.slotLock.RLock()
+	defer s.slotLock.RUnlock()
+
+	free := make(map[uint32]struct{}, len(s.free))
+	for _, index := range s.free {
+		free[index] = struct{}{}
+	}
+
+	types := &snapshotTypes{names: []string{}, indexes: map[reflect.Type]int{}}
+	result := snapshot{
+		Version:  snapshotVersion,
+		Slots:    make([]snapshotSlot, len(s.slots)),
+		Free:     append([]uint32{}, s.free...),
+		Entities: []snapshotEntity{},
+	}
+
+	for index, slot := range s.slots {
+		result.Slots[index] = snapshotSlot{Generation: slot.generation, Alive: slot.alive}
+		if !slot.alive {
+			if _, exists := free[uint32(index)]; index > 0 && !exists {
+				return fmt.Errorf("slot %v is reserved by a pending command, flush commands before taking a snapshot", index)
+			}
+			continue
+		}
+
+		id := NewEntityId(uint32(index), slot.generation)
+		entity := snapshotEntity{Id: id, Components: []snapshotComponent{}}
+
+		components := s.Storage.Get(id)
+		sort.Slice(components, func(a int, b int) bool {
+			return reflect.TypeOf(components[a]).String() < reflect.TypeOf(components[b]).String()
+		})
+		for _, component := range components {
+			typeIndex, err := types.component(reflect.TypeOf(component))
+			if err != nil {
+				return fmt.Errorf("failed to snapshot entity %v: %w", id, err)
+			}
+
+			data, err := json.Marshal(component)
+			if err != nil {
+				return fmt.Errorf("failed to snapshot entity %v: %w", id, err)
+			}
+			entity.Components = append(entity.Components, snapshotComponent{Type: typeIndex, Data: data})
+		}
+
+		for _, relation := range s.Storage.Relations(id) {
+			info, exists := GetComponentInfo(relation.Relation)
+			if !exists {
+				return fmt.Errorf("failed to snapshot relations of entity %v: relation %v is not registered", id, relation.Relation)
+			}
+			typeIndex, err := types.index(info.Type)
+			if err != nil {
+				return fmt.Errorf("failed to snapshot relations of entity %v: %w", id, err)
+			}
+			entity.Relations = append(entity.Relations, snapshotRelation{Type: typeIndex, Target: relation.Target})
+		}
+
+		result.Entities = append(result.Entities, entity)
+	}
+
+	result.Types = types.names
+	return json.NewEncoder(writer).Encode(result)
+}
+
+// Restore replaces every entity within the simulation with those of a snapshot written by
+// Snapshot. The simulation is left unchanged if the snapshot is invalid. Existing entities
+// are removed without being reported to RemovedComponents or DespawnedEntities readers, and
+// any pending commands are discarded as the entities they refer to are replaced.
+func (s *Simulation) Restore(reader io.Reader) error {
+	var data snapshot
+	if err := json.NewDecoder(reader).Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if data.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %v, expected %v", data.Version, snapshotVersion)
+	}
+
+	types := make([]reflect.Type, len(data.Types))
+	for index, name := range data.Types {
+		componentType, exists := ComponentTypeByName(name)
+		if !exists {
+			return fmt.Errorf("snapshot references unregistered type %v", name)
+		}
+		types[index] = componentType
+	}
+	resolve := func(index int) (reflect.Type, error) {
+		if index < 0 || index >= len(types) {
+			return nil, fmt.Errorf("snapshot references unknown type index %v", index)
+		}
+		return types[index], nil
+	}
+
+	if len(data.Slots) == 0 {
+		return fmt.Errorf("snapshot contains no entity slots")
+	}
+	isAlive := func(id EntityId) bool {
+		index := id.Index()
+		return index > 0 && index < uint32(len(data.Slots)) &&
+			data.Slots[index].Alive && data.Slots[index].Generation == id.Generation()
+	}
+
+	// free slots are reused by the next entities added, so they must be valid dead slots
+	free := make(map[uint32]struct{}, len(data.Free))
+	for _, index := range data.Free {
+		if index == 0 || index >= uint32(len(data.Slots)) || data.Slots[index].Alive {
+			return fmt.Errorf("snapshot free slot %v is not a dead entity slot", index)
+		}
+		if _, exists := free[index]; exists {
+			return fmt.Errorf("snapshot free slot %v is listed more than once", index)
+		}
+		free[index] = struct{}{}
+	}
+	// every other dead slot must be free, otherwise it could never be reused
+	for index, slot := range data.Slots {
+		if _, exists := free[uint32(index)]; index > 0 && !slot.Alive && !exists {
+			return fmt.Errorf("snapshot slot %v is dead but not free", index)
+		}
+	}
+
+	// decode everything before modifying the simulation, so that errors leave it untouched
+	restored := make(map[EntityId]struct{}, len(data.Entities))
+	entities := make([][]interface{}, len(data.Entities))
+	for entityIdx, entity := range data.Entities {
+		if !isAlive(entity.Id) {
+			return fmt.Errorf("snapshot entity %v does not match its slot", entity.Id)
+		}
+		if _, exists := restored[entity.Id]; exists {
+			return fmt.Errorf("snapshot entity %v is listed more than once", entity.Id)
+		}
+		restored[entity.Id] = struct{}{}
+
+		entities[entityIdx] = make([]interface{}, len(entity.Components))
+		for componentIdx, component := range entity.Components {
+			componentType, err := resolve(component.Type)
+			if err != nil {
+				return fmt.Errorf("failed to restore entity %v: %w", entity.Id, err)
+			}
+
+			value := reflect.New(componentType)
+			if err := json.Unmarshal(component.Data, value.Interface()); err != nil {
+				return fmt.Errorf("failed to restore %v of entity %v: %w", data.Types[component.Type], entity.Id, err)
+			}
+			entities[entityIdx][componentIdx] = value.Interface()
+		}
+
+		for _, relation := range entity.Relations {
+			if _, err := resolve(relation.Type); err != nil {
+				return fmt.Errorf("failed to restore relations of entity %v: %w", entity.Id, err)
+			}
+			if !isAlive(relation.Target) {
+				return fmt.Errorf("entity %v has a relation to missing entity %v", entity.Id, relation.Target)
+			}
+		}
+	}
+
+	for index, slot := range data.Slots {
+		if _, exists := restored[NewEntityId(uint32(index), slot.Generation)]; slot.Alive && !exists {
+			return fmt.Errorf("snapshot slot %v is alive but has no entity", index)
+		}
+	}
+
+	s.slotLock.Lock()
+	for index, slot := range s.slots {
+		if slot.alive {
+			s.Storage.Delete(NewEntityId(uint32(index), slot.generation))
+		}
+	}
+
+	s.slots = make([]entitySlot, len(data.Slots))
+	for index, slot := range data.Slots {
+		s.slots[index] = entitySlot{generation: slot.Generation, alive: slot.Alive}
+	}
+	s.free = append([]uint32{}, data.Free...)
+	s.slotLock.Unlock()
+	s.Frame.Commands.clear()
+
+	for entityIdx, entity := range data.Entities {
+		// components where decoded into registered types, so they can always be added
+		if err := s.Storage.Add(entity.Id, entities[entityIdx]...); err != nil {
+			return fmt.Errorf("failed to restore entity %v: %w", entity.Id, err)
+		}
+	}
+	for _, entity := range data.Entities {
+		for _, relation := range entity.Relations {
+			s.Storage.AddRelation(entity.Id, componentIdOf(reflect.PointerTo(types[relation.Type])), relation.Target)
+		}
+	}
+	return nil
+}
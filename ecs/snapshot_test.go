@@ -0,0 +1,133 @@
+package ecs
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	sim := NewSimpleSimulation()
+	ids := []EntityId{}
+	for n := 0; n < 20; n++ {
+		ids = append(ids, sim.AddEntity(&componentA{A: float64(n)}, &componentB{B: int64(n * 2)}))
+	}
+	for n := 0; n < 20; n += 3 {
+		sim.DeleteEntity(ids[n])
+	}
+	recycled := sim.AddEntity(&componentC{C: true}, &NameComponent{Name: "recycled"})
+	assert.NoError(t, sim.SetParent(ids[1], recycled))
+	assert.NoError(t, sim.SetParent(ids[2], recycled))
+	assert.NoError(t, AddRelation[likesRelation](sim, ids[4], recycled))
+
+	var buffer bytes.Buffer
+	assert.NoError(t, sim.Snapshot(&buffer))
+
+	restored := NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor())
+	restored.AddEntity(&componentA{A: 100})
+	assert.NoError(t, restored.Restore(&buffer))
+
+	for _, id := range append(ids, recycled) {
+		assert.Equal(t, sim.IsAlive(id), restored.IsAlive(id))
+		if sim.IsAlive(id) {
+			assert.ElementsMatch(t, sim.Storage.Get(id), restored.Storage.Get(id))
+		}
+	}
+	assert.Equal(t, []EntityId{ids[1], ids[2]}, restored.Children(recycled))
+	assert.Equal(t, []EntityId{ids[4]}, RelationSources[likesRelation](restored, recycled))
+	assert.Len(t, NewQuery[struct{ A *componentA }]().Execute(restored).ToList(), 13, "existing entities should be replaced")
+
+	// the id allocator must continue exactly where the original left off
+	assert.Equal(t, sim.AddEntity(), restored.AddEntity())
+	assert.Equal(t, sim.AddEntity(), restored.AddEntity())
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	// components and relations must be registered to be added, so only storages used
+	// directly can hold unregistered relations
+	sim := NewSimpleSimulation()
+	ship := sim.AddEntity(&componentA{A: 1})
+	target := sim.AddEntity()
+	sim.Storage.AddRelation(ship, invalidComponentId, target)
+	assert.ErrorContains(t, sim.Snapshot(&bytes.Buffer{}), "not registered")
+	sim.Storage.RemoveRelation(ship, invalidComponentId, target)
+	assert.NoError(t, sim.Snapshot(&bytes.Buffer{}))
+
+	// unexported fields would be dropped, so components with them can not be saved
+	sim.AddEntity(&testComponent{a: 1})
+	assert.ErrorContains(t, sim.Snapshot(&bytes.Buffer{}), "field a of ecs.testComponent is unexported")
+	assert.NoError(t, checkExportedFields(reflect.TypeOf(&snapshotExportedComponent{}), map[reflect.Type]struct{}{}))
+
+	// ids reserved by pending spawns are neither alive nor free
+	pending := NewSimpleSimulation()
+	_, err := pending.Frame.Commands.Spawn(&componentA{A: 1})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, pending.Snapshot(&bytes.Buffer{}), "pending command")
+	pending.Frame.Commands.Flush()
+	assert.NoError(t, pending.Snapshot(&bytes.Buffer{}))
+
+	restored := NewSimpleSimulation()
+	existing := restored.AddEntity(&componentA{A: 1})
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(`{"version": 1000}`)), "version")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": ["missing"], "slots": [{}], "free": [], "entities": []}`,
+	)), "unregistered type missing")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": ["test.A"], "slots": [{}, {"alive": true}], "free": [],
+		  "entities": [{"id": 1, "components": [{"type": 0, "data": {"A": "invalid"}}]}]}`,
+	)), "test.A")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}], "free": [5], "entities": [{"id": 1}]}`,
+	)), "free slot 5")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}], "free": [0], "entities": [{"id": 1}]}`,
+	)), "free slot 0")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}], "free": [1], "entities": [{"id": 1}]}`,
+	)), "free slot 1")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}, {}], "free": [2, 2], "entities": [{"id": 1}]}`,
+	)), "more than once")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}], "free": [], "entities": [{"id": 1}, {"id": 1}]}`,
+	)), "entity 1:0 is listed more than once")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}, {"alive": true}], "free": [], "entities": [{"id": 1}]}`,
+	)), "slot 2 is alive")
+	assert.ErrorContains(t, restored.Restore(strings.NewReader(
+		`{"version": 1, "types": [], "slots": [{}, {"alive": true}, {}], "free": [], "entities": [{"id": 1}]}`,
+	)), "slot 2 is dead but not free")
+	assert.True(t, restored.IsAlive(existing), "failed restores should leave the simulation untouched")
+}
+
+// snapshotExportedComponent only has fields which are saved, including those of embedded
+// unexported structs and types which encode themselves.
+type snapshotExportedComponent struct {
+	snapshotEmbedded
+	Time    time.Time
+	Ignored int `json:"-"`
+}
+
+type snapshotEmbedded struct {
+	Value int
+}
+
+func TestRestoreDiscardsCommands(t *testing.T) {
+	sim := NewSimpleSimulation()
+	sim.AddEntity(&componentA{A: 1})
+	var buffer bytes.Buffer
+	assert.NoError(t, sim.Snapshot(&buffer))
+
+	// the reserved id refers to a slot which is replaced by the restore
+	reserved, err := sim.Frame.Commands.Spawn(&componentA{A: 2})
+	assert.NoError(t, err)
+	assert.NoError(t, sim.Restore(&buffer))
+	assert.Equal(t, 0, sim.Frame.Commands.Len())
+	sim.Frame.Commands.Flush()
+	assert.False(t, sim.IsAlive(reserved))
+	assert.Len(t, NewQuery[struct{ A *componentA }]().Execute(sim).ToList(), 1)
+}
@@ -1,28 +1,180 @@
 package ecs
 
 import (
+	"fmt"
+	"iter"
 	"reflect"
 )
 
-type EntityId = uint32
+// EntityId identifies an entity. The lower 32 bits hold the index of the slot the entity
+// occupies and the upper 32 bits hold the generation of that slot, which is bumped each
+// time the slot is recycled so that ids held past an entity's deletion can be detected.
+type EntityId uint64
 
-var entityIdType reflect.Type
+func NewEntityId(index uint32, generation uint32) EntityId {
+	return EntityId(uint64(generation)<<32 | uint64(index))
+}
+
+// Index returns the slot index of this entity id.
+func (id EntityId) Index() uint32 {
+	return uint32(id)
+}
 
-func init() {
-	var empty EntityId
-	entityIdType = reflect.TypeOf(empty)
+// Generation returns the generation of the slot at the time this entity id was created.
+func (id EntityId) Generation() uint32 {
+	return uint32(id >> 32)
 }
 
+func (id EntityId) String() string {
+	return fmt.Sprintf("%d:%d", id.Index(), id.Generation())
+}
+
+// entityIdType is initialized as a package variable (rather than within init) so that it
+// is available to queries created by other package variables.
+var entityIdType = reflect.TypeOf(EntityId(0))
+
 /// EntityStorage manages storing, mutating, and querying a set of entities, described
-///  by their components.
+///  by their components. Storages may move components as entities are deleted or have
+///  components added or removed (see EntityArchetypeStorage), so pointers to components
+///  should not be kept across those changes.
 type EntityStorage interface {
-	Add(EntityId, ...interface{})
+	// Add stores a new entity with the given components, which must be of registered
+	// component types. Components passed by value are copied into a pointer. Adding an
+	// existing entity returns ErrDuplicateEntity.
+	Add(EntityId, ...interface{}) error
 	Delete(EntityId)
 	Get(EntityId) []interface{}
-	GetComponent(EntityId, reflect.Type) interface{}
-	RemoveComponent(EntityId, reflect.Type)
-	AddComponent(EntityId, interface{})
-	FindAll([]reflect.Type) []EntityId
+	// Entities iterates the id of every entity within the storage. The storage must not be
+	// structurally changed during iteration.
+	Entities() iter.Seq[EntityId]
+	// Components iterates the components of an entity along with their ids.
+	Components(EntityId) iter.Seq2[ComponentId, interface{}]
+	GetComponent(EntityId, ComponentId) interface{}
+	RemoveComponent(EntityId, ComponentId)
+	// AddComponent adds or replaces a component of an existing entity, returning
+	// ErrEntityNotFound if the entity does not exist. Components passed by value are copied
+	// into a pointer.
+	AddComponent(EntityId, interface{}) error
+	// SetComponent is AddComponent for a component which is already a pointer of the
+	// registered type with the given id, avoiding reflection. It returns whether the
+	// component was newly added rather than replaced.
+	SetComponent(EntityId, ComponentId, interface{}) (bool, error)
+	FindAll(QueryFilter) []EntityId
+	// AppendAll appends the entities matching the filter to the given slice, allowing callers
+	// to reuse a buffer between queries.
+	AppendAll([]EntityId, QueryFilter) []EntityId
+	// CacheQuery registers a filter with the storage, which maintains the set of entities
+	// matching its components from then on. Caches are kept up to date until they are
+	// released with ReleaseQuery.
+	CacheQuery(QueryFilter) QueryCache
+	// ReleaseQuery stops the storage from maintaining a cache created by CacheQuery.
+	ReleaseQuery(QueryCache)
+
+	// TryDelete is Delete, returning ErrEntityNotFound if the entity does not exist.
+	TryDelete(EntityId) error
+	// TryGetComponent is GetComponent, returning ErrEntityNotFound or ErrComponentNotFound
+	// instead of nil.
+	TryGetComponent(EntityId, ComponentId) (interface{}, error)
+	// TryRemoveComponent is RemoveComponent, returning ErrEntityNotFound or
+	// ErrComponentNotFound if there was nothing to remove.
+	TryRemoveComponent(EntityId, ComponentId) error
+
+	// ChangeTick returns the tick newly added or changed components are stamped with.
+	ChangeTick() uint64
+	// AdvanceChangeTick increments and returns the change tick, called before each system runs.
+	AdvanceChangeTick() uint64
+	// MarkChanged stamps an entity's component of the given type as changed.
+	MarkChanged(EntityId, ComponentId)
+	// ComponentTicks returns when an entity's component of the given type was added and
+	// last changed.
+	ComponentTicks(EntityId, ComponentId) (ComponentTicks, bool)
+
+	// AddRelation adds a relation pair of the given type from a source entity to a target.
+	AddRelation(source EntityId, relation ComponentId, target EntityId)
+	// RemoveRelation removes a relation pair from a source entity to a target.
+	RemoveRelation(source EntityId, relation ComponentId, target EntityId)
+	// HasRelation returns whether a source entity has a relation pair to the target, or to
+	// any target if the target is zero.
+	HasRelation(source EntityId, relation ComponentId, target EntityId) bool
+	// RelationTargets returns the targets of a source entity's relations of the given type.
+	RelationTargets(source EntityId, relation ComponentId) []EntityId
+	// RelationSources returns the entities with a relation of the given type to the target.
+	RelationSources(relation ComponentId, target EntityId) []EntityId
+	// Relations returns every relation pair of a source entity.
+	Relations(source EntityId) []RelationFilter
+}
+
+// QueryFilter describes the set of entities a query matches based on their components.
+type QueryFilter struct {
+	// With lists component types an entity must have.
+	With []ComponentId
+	// Without lists component types an entity must not have.
+	Without []ComponentId
+	// AnyOf lists groups of component types, an entity must have at least one component type
+	// from each group.
+	AnyOf [][]ComponentId
+	// Added lists component types which must have been added after the Since tick.
+	Added []ComponentId
+	// Changed lists component types which must have been changed after the Since tick.
+	Changed []ComponentId
+	// Since is the change tick added and changed components are compared against.
+	Since uint64
+	// Relations lists relations entities must have.
+	Relations []RelationFilter
+	// WithoutRelations lists relation types entities must not have to any target.
+	WithoutRelations []ComponentId
+}
+
+// Matches returns whether an entity matches the filter, given a function which reports
+// whether the entity has a component of the given type.
+func (f QueryFilter) Matches(has func(ComponentId) bool) bool {
+	for _, component := range f.With {
+		if !has(component) {
+			return false
+		}
+	}
+
+	for _, component := range f.Without {
+		if has(component) {
+			return false
+		}
+	}
+
+	for _, group := range f.AnyOf {
+		matched := false
+		for _, component := range group {
+			if has(component) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// rowStorage is implemented by storages which can locate an entity once and then read each
+// of its components from the same row, sparing queries a lookup of the entity per field.
+type rowStorage interface {
+	locateRow(EntityId) (entityRow, bool)
+}
+
+// componentRows holds the components of a set of entities by row.
+type componentRows interface {
+	component(row int, componentType ComponentId) interface{}
+}
+
+// entityRow is the location of an entity within a rowStorage.
+type entityRow struct {
+	rows componentRows
+	row  int
+}
+
+// component returns the entity's component of the given type, or nil if it has none.
+func (r entityRow) component(componentType ComponentId) interface{} {
+	return r.rows.component(r.row, componentType)
 }
 
 type EntityIterator interface {
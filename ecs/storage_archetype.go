@@ -0,0 +1,583 @@
+package ecs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// emptyInterface is the layout of an interface{} value.
+type emptyInterface struct {
+	typ  unsafe.Pointer
+	data unsafe.Pointer
+}
+
+// columnPageBytes is the approximate size of each page of a column.
+const columnPageBytes = 16 << 10
+
+// column stores every component of a single type within an archetype by value. Components
+// are stored contiguously within fixed size pages, so that growing the column never moves
+// existing components and pointers to them stay valid until their row is removed.
+type column struct {
+	componentType reflect.Type
+	// pointerType is the type word of an interface holding a pointer to the component type
+	pointerType unsafe.Pointer
+	size        uintptr
+	perPage     int
+	pages       []unsafe.Pointer
+	// ticks holds the change ticks of each row, and its length is the length of the column
+	ticks []ComponentTicks
+}
+
+func newColumn(componentType ComponentId) *column {
+	info, exists := GetComponentInfo(componentType)
+	if !exists {
+		log.Panicf("component %v is not registered", componentType)
+	}
+
+	pointer := reflect.Zero(info.Type).Interface()
+	result := &column{
+		componentType: info.Type.Elem(),
+		pointerType:   (*emptyInterface)(unsafe.Pointer(&pointer)).typ,
+		size:          info.Type.Elem().Size(),
+		perPage:       columnPageBytes,
+		pages:         []unsafe.Pointer{},
+		ticks:         []ComponentTicks{},
+	}
+	if result.size > 0 {
+		result.perPage = int((columnPageBytes + result.size - 1) / result.size)
+	}
+	return result
+}
+
+// pointer returns the address of the component stored at row.
+func (c *column) pointer(row int) unsafe.Pointer {
+	return unsafe.Add(c.pages[row/c.perPage], uintptr(row%c.perPage)*c.size)
+}
+
+// value returns the component stored at row, which may be used to read or set it.
+func (c *column) value(row int) reflect.Value {
+	return reflect.NewAt(c.componentType, c.pointer(row)).Elem()
+}
+
+// get returns a pointer to the component stored at row. Pointers are stored directly within
+// interfaces, so the interface is built from the pointer rather than through reflection which
+// is far slower when reading every field of every entity.
+func (c *column) get(row int) interface{} {
+	var result interface{}
+	*(*emptyInterface)(unsafe.Pointer(&result)) = emptyInterface{typ: c.pointerType, data: c.pointer(row)}
+	return result
+}
+
+// set copies the given pointer's component into row.
+func (c *column) set(row int, component interface{}) {
+	c.value(row).Set(reflect.ValueOf(component).Elem())
+}
+
+// push appends a zeroed row.
+func (c *column) push() {
+	if len(c.ticks) == len(c.pages)*c.perPage {
+		page := reflect.New(reflect.ArrayOf(c.perPage, c.componentType))
+		c.pages = append(c.pages, page.UnsafePointer())
+	}
+	c.ticks = append(c.ticks, ComponentTicks{})
+}
+
+// swapRemove removes the given row by moving the last row into its place, zeroing the last
+// row so that it does not keep anything the component referenced alive.
+func (c *column) swapRemove(row int) {
+	last := len(c.ticks) - 1
+	if row != last {
+		c.value(row).Set(c.value(last))
+		c.ticks[row] = c.ticks[last]
+	}
+	c.value(last).SetZero()
+	c.ticks = c.ticks[:last]
+}
+
+// archetype holds every entity which shares an identical set of component types. Each
+// component type is stored within its own column, with rows aligned to the entities slice.
+type archetype struct {
+	key      string
+	types    []ComponentId
+	entities []EntityId
+	columns  []*column
+
+	// cached transitions to the archetype produced by adding or removing a component type
+	addEdges    map[ComponentId]*archetype
+	removeEdges map[ComponentId]*archetype
+}
+
+// column returns the index of the column storing the given type, or -1 if this archetype
+// does not contain the type. Archetypes generally contain a small number of types so a
+// linear scan beats hashing the id.
+func (a *archetype) column(component ComponentId) int {
+	for index, columnType := range a.types {
+		if columnType == component {
+			return index
+		}
+	}
+	return -1
+}
+
+func (a *archetype) has(component ComponentId) bool {
+	return a.column(component) != -1
+}
+
+// component returns the component of the given type for the entity stored at row.
+func (a *archetype) component(row int, component ComponentId) interface{} {
+	column := a.column(component)
+	if column == -1 {
+		return nil
+	}
+	return a.columns[column].get(row)
+}
+
+// push appends a new row for the given entity, returning the row index. Columns are left
+// zeroed and must be filled in by the caller.
+func (a *archetype) push(id EntityId) int {
+	a.entities = append(a.entities, id)
+	for _, column := range a.columns {
+		column.push()
+	}
+	return len(a.entities) - 1
+}
+
+// swapRemove removes the given row by moving the last row into its place. If a row was
+// moved the id of the moved entity is returned so its location can be updated.
+func (a *archetype) swapRemove(row int) (EntityId, bool) {
+	last := len(a.entities) - 1
+	moved := row != last
+	a.entities[row] = a.entities[last]
+	a.entities = a.entities[:last]
+	for _, column := range a.columns {
+		column.swapRemove(row)
+	}
+
+	if moved {
+		return a.entities[row], true
+	}
+	return 0, false
+}
+
+type entityLocation struct {
+	archetype *archetype
+	row       int
+}
+
+func (a *archetype) matchesTicks(filter QueryFilter, row int) bool {
+	return filter.MatchesTicks(func(component ComponentId) (ComponentTicks, bool) {
+		column := a.column(component)
+		if column == -1 {
+			return ComponentTicks{}, false
+		}
+		return a.columns[column].ticks[row], true
+	})
+}
+
+// archetypeCache caches the archetypes matching the components of a filter. Archetypes are
+// never removed, so the storage only needs to append newly created archetypes which match.
+type archetypeCache struct {
+	storage    *EntityArchetypeStorage
+	filter     QueryFilter
+	archetypes []*archetype
+}
+
+func (c *archetypeCache) FindAll(filter QueryFilter) []EntityId {
+	return c.AppendAll([]EntityId{}, filter)
+}
+
+func (c *archetypeCache) AppendAll(result []EntityId, filter QueryFilter) []EntityId {
+	c.storage.cacheLock.RLock()
+	defer c.storage.cacheLock.RUnlock()
+
+	for _, archetype := range c.archetypes {
+		result = c.storage.appendMatches(result, archetype, filter)
+	}
+	return result
+}
+
+/// EntityArchetypeStorage groups entities by their set of component types (archetypes),
+///  storing each component type within a contiguous column. Queries only visit the
+///  archetypes which match, making it well suited for large numbers of entities which
+///  rarely change shape. Components are copied into their column, so pointers to them are
+///  only valid until the entity's component types change or another entity in the same
+///  archetype is removed.
+type EntityArchetypeStorage struct {
+	changeTicker
+	relationIndex
+
+	archetypes map[string]*archetype
+	list       []*archetype
+	entities   map[EntityId]entityLocation
+
+	// cacheLock guards the cached queries, which may be registered by queries executing concurrently
+	cacheLock sync.RWMutex
+	caches    []*archetypeCache
+}
+
+func NewEntityArchetypeStorage() *EntityArchetypeStorage {
+	storage := &EntityArchetypeStorage{
+		relationIndex: newRelationIndex(),
+		archetypes:    map[string]*archetype{},
+		list:          []*archetype{},
+		entities:      map[EntityId]entityLocation{},
+	}
+	storage.archetype([]ComponentId{})
+	return storage
+}
+
+// archetype returns the archetype for the given set of component types, creating it if
+// it does not exist yet. The passed slice is sorted in place, so that each archetype has a
+// stable key regardless of the order its components where added in.
+func (e *EntityArchetypeStorage) archetype(componentTypes []ComponentId) *archetype {
+	sort.Slice(componentTypes, func(i, j int) bool {
+		return componentTypes[i] < componentTypes[j]
+	})
+
+	keyBytes := make([]byte, len(componentTypes)*4)
+	for index, componentType := range componentTypes {
+		binary.LittleEndian.PutUint32(keyBytes[index*4:], uint32(componentType))
+	}
+	key := string(keyBytes)
+
+	if existing, exists := e.archetypes[key]; exists {
+		return existing
+	}
+
+	result := &archetype{
+		key:         key,
+		types:       componentTypes,
+		entities:    []EntityId{},
+		columns:     make([]*column, len(componentTypes)),
+		addEdges:    map[ComponentId]*archetype{},
+		removeEdges: map[ComponentId]*archetype{},
+	}
+	for index, componentType := range componentTypes {
+		result.columns[index] = newColumn(componentType)
+	}
+
+	e.archetypes[key] = result
+	e.list = append(e.list, result)
+
+	e.cacheLock.Lock()
+	for _, cache := range e.caches {
+		if cache.filter.Matches(result.has) {
+			cache.archetypes = append(cache.archetypes, result)
+		}
+	}
+	e.cacheLock.Unlock()
+	return result
+}
+
+func (e *EntityArchetypeStorage) withComponent(from *archetype, componentType ComponentId) *archetype {
+	if to, exists := from.addEdges[componentType]; exists {
+		return to
+	}
+
+	componentTypes := make([]ComponentId, len(from.types), len(from.types)+1)
+	copy(componentTypes, from.types)
+	to := e.archetype(append(componentTypes, componentType))
+	from.addEdges[componentType] = to
+	to.removeEdges[componentType] = from
+	return to
+}
+
+func (e *EntityArchetypeStorage) withoutComponent(from *archetype, componentType ComponentId) *archetype {
+	if to, exists := from.removeEdges[componentType]; exists {
+		return to
+	}
+
+	componentTypes := make([]ComponentId, 0, len(from.types))
+	for _, existingType := range from.types {
+		if existingType != componentType {
+			componentTypes = append(componentTypes, existingType)
+		}
+	}
+	to := e.archetype(componentTypes)
+	from.removeEdges[componentType] = to
+	to.addEdges[componentType] = from
+	return to
+}
+
+// remove takes the entity out of its current archetype, fixing up the location of any
+// entity that was moved to fill the gap.
+func (e *EntityArchetypeStorage) remove(location entityLocation) {
+	if moved, ok := location.archetype.swapRemove(location.row); ok {
+		e.entities[moved] = location
+	}
+}
+
+// move transfers an entity between archetypes, copying over every component (and its
+// ticks) the destination archetype shares with the source.
+func (e *EntityArchetypeStorage) move(id EntityId, from entityLocation, to *archetype) entityLocation {
+	row := to.push(id)
+	for column, componentType := range to.types {
+		if fromColumn := from.archetype.column(componentType); fromColumn != -1 {
+			to.columns[column].value(row).Set(from.archetype.columns[fromColumn].value(from.row))
+			to.columns[column].ticks[row] = from.archetype.columns[fromColumn].ticks[from.row]
+		}
+	}
+	e.remove(from)
+
+	location := entityLocation{archetype: to, row: row}
+	e.entities[id] = location
+	return location
+}
+
+// locateRow returns the archetype row an entity is stored within.
+func (e *EntityArchetypeStorage) locateRow(id EntityId) (entityRow, bool) {
+	location, exists := e.entities[id]
+	if !exists {
+		return entityRow{}, false
+	}
+	return entityRow{rows: location.archetype, row: location.row}, true
+}
+
+func (e *EntityArchetypeStorage) Add(id EntityId, components ...interface{}) error {
+	if _, exists := e.entities[id]; exists {
+		return fmt.Errorf("%w: %v", ErrDuplicateEntity, id)
+	}
+
+	// later components of the same type replace earlier ones, matching EntitySimpleStorage
+	byType := make(map[ComponentId]interface{}, len(components))
+	componentTypes := make([]ComponentId, 0, len(components))
+	for _, component := range components {
+		component, info, err := resolveComponent(component)
+		if err != nil {
+			return err
+		}
+		if _, exists := byType[info.Id]; !exists {
+			componentTypes = append(componentTypes, info.Id)
+		}
+		byType[info.Id] = component
+	}
+
+	target := e.archetype(componentTypes)
+	row := target.push(id)
+	tick := e.ChangeTick()
+	for column, componentType := range target.types {
+		target.columns[column].set(row, byType[componentType])
+		target.columns[column].ticks[row] = newComponentTicks(tick)
+	}
+	e.entities[id] = entityLocation{archetype: target, row: row}
+	return nil
+}
+
+func (e *EntityArchetypeStorage) Delete(id EntityId) {
+	location, exists := e.entities[id]
+	if !exists {
+		return
+	}
+
+	e.remove(location)
+	delete(e.entities, id)
+	e.deleteRelations(id)
+}
+
+func (e *EntityArchetypeStorage) TryDelete(id EntityId) error {
+	if _, exists := e.entities[id]; !exists {
+		return fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+	e.Delete(id)
+	return nil
+}
+
+func (e *EntityArchetypeStorage) FindAll(filter QueryFilter) []EntityId {
+	return e.AppendAll([]EntityId{}, filter)
+}
+
+func (e *EntityArchetypeStorage) AppendAll(result []EntityId, filter QueryFilter) []EntityId {
+	for _, archetype := range e.list {
+		// every entity within an archetype shares the same components, so the filter only
+		// needs to be checked once per archetype
+		if len(archetype.entities) == 0 || !filter.Matches(archetype.has) {
+			continue
+		}
+		result = e.appendMatches(result, archetype, filter)
+	}
+	return result
+}
+
+// appendMatches appends the entities of an archetype matching the change ticks and relations
+// of the filter, which must already match the components of the archetype.
+func (e *EntityArchetypeStorage) appendMatches(result []EntityId, archetype *archetype, filter QueryFilter) []EntityId {
+	if !filter.tracksChanges() && !filter.tracksRelations() {
+		return append(result, archetype.entities...)
+	}
+
+	for row, id := range archetype.entities {
+		if filter.tracksChanges() && !archetype.matchesTicks(filter, row) {
+			continue
+		}
+		if filter.tracksRelations() && !e.matchesRelations(filter, id) {
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
+func (e *EntityArchetypeStorage) ReleaseQuery(cache QueryCache) {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+
+	for index, existing := range e.caches {
+		if existing == cache {
+			e.caches = append(e.caches[:index], e.caches[index+1:]...)
+			return
+		}
+	}
+}
+
+func (e *EntityArchetypeStorage) CacheQuery(filter QueryFilter) QueryCache {
+	cache := &archetypeCache{
+		storage: e,
+		filter:  QueryFilter{With: filter.With, Without: filter.Without, AnyOf: filter.AnyOf},
+	}
+
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	for _, archetype := range e.list {
+		if cache.filter.Matches(archetype.has) {
+			cache.archetypes = append(cache.archetypes, archetype)
+		}
+	}
+	e.caches = append(e.caches, cache)
+	return cache
+}
+
+func (e *EntityArchetypeStorage) GetComponent(id EntityId, componentType ComponentId) interface{} {
+	location, exists := e.entities[id]
+	if !exists {
+		return nil
+	}
+	return location.archetype.component(location.row, componentType)
+}
+
+func (e *EntityArchetypeStorage) TryGetComponent(id EntityId, componentType ComponentId) (interface{}, error) {
+	location, exists := e.entities[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	component := location.archetype.component(location.row, componentType)
+	if component == nil {
+		return nil, fmt.Errorf("%w: entity %v has no component %v", ErrComponentNotFound, id, componentType)
+	}
+	return component, nil
+}
+
+func (e *EntityArchetypeStorage) Entities() iter.Seq[EntityId] {
+	return func(yield func(EntityId) bool) {
+		for _, archetype := range e.list {
+			for _, id := range archetype.entities {
+				if !yield(id) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *EntityArchetypeStorage) Components(id EntityId) iter.Seq2[ComponentId, interface{}] {
+	return func(yield func(ComponentId, interface{}) bool) {
+		location, exists := e.entities[id]
+		if !exists {
+			return
+		}
+
+		for column, componentType := range location.archetype.types {
+			if !yield(componentType, location.archetype.columns[column].get(location.row)) {
+				return
+			}
+		}
+	}
+}
+
+func (e *EntityArchetypeStorage) Get(id EntityId) []interface{} {
+	location, exists := e.entities[id]
+	if !exists {
+		return []interface{}{}
+	}
+
+	result := make([]interface{}, len(location.archetype.columns))
+	for column := range location.archetype.columns {
+		result[column] = location.archetype.columns[column].get(location.row)
+	}
+	return result
+}
+
+func (e *EntityArchetypeStorage) RemoveComponent(id EntityId, componentType ComponentId) {
+	location, exists := e.entities[id]
+	if !exists || !location.archetype.has(componentType) {
+		return
+	}
+
+	e.move(id, location, e.withoutComponent(location.archetype, componentType))
+}
+
+func (e *EntityArchetypeStorage) TryRemoveComponent(id EntityId, componentType ComponentId) error {
+	if _, err := e.TryGetComponent(id, componentType); err != nil {
+		return err
+	}
+	e.RemoveComponent(id, componentType)
+	return nil
+}
+
+func (e *EntityArchetypeStorage) AddComponent(id EntityId, component interface{}) error {
+	component, info, err := resolveComponent(component)
+	if err != nil {
+		return err
+	}
+	_, err = e.SetComponent(id, info.Id, component)
+	return err
+}
+
+func (e *EntityArchetypeStorage) SetComponent(id EntityId, componentType ComponentId, component interface{}) (bool, error) {
+	location, exists := e.entities[id]
+	if !exists {
+		return false, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	if column := location.archetype.column(componentType); column != -1 {
+		location.archetype.columns[column].set(location.row, component)
+		location.archetype.columns[column].ticks[location.row].Changed = e.ChangeTick()
+		return false, nil
+	}
+
+	location = e.move(id, location, e.withComponent(location.archetype, componentType))
+	column := location.archetype.column(componentType)
+	location.archetype.columns[column].set(location.row, component)
+	location.archetype.columns[column].ticks[location.row] = newComponentTicks(e.ChangeTick())
+	return true, nil
+}
+
+func (e *EntityArchetypeStorage) MarkChanged(id EntityId, componentType ComponentId) {
+	location, exists := e.entities[id]
+	if !exists {
+		return
+	}
+
+	if column := location.archetype.column(componentType); column != -1 {
+		location.archetype.columns[column].ticks[location.row].Changed = e.ChangeTick()
+	}
+}
+
+func (e *EntityArchetypeStorage) ComponentTicks(id EntityId, componentType ComponentId) (ComponentTicks, bool) {
+	location, exists := e.entities[id]
+	if !exists {
+		return ComponentTicks{}, false
+	}
+
+	column := location.archetype.column(componentType)
+	if column == -1 {
+		return ComponentTicks{}, false
+	}
+	return location.archetype.columns[column].ticks[location.row], true
+}
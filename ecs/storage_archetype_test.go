@@ -0,0 +1,142 @@
+package ecs
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchetypeStorageAdd(t *testing.T) {
+	testStorageAdd(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageEmptyQuery(t *testing.T) {
+	testStorageEmptyQuery(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageSimpleQuery(t *testing.T) {
+	testStorageSimpleQuery(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageAddRemoveComponent(t *testing.T) {
+	testStorageAddRemoveComponent(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageValueComponents(t *testing.T) {
+	testStorageValueComponents(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageErrors(t *testing.T) {
+	testStorageErrors(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageParForEach(t *testing.T) {
+	testStorageParForEach(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageCachedQuery(t *testing.T) {
+	testStorageCachedQuery(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageIterators(t *testing.T) {
+	testStorageIterators(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageFilters(t *testing.T) {
+	testStorageFilters(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageChangeTicks(t *testing.T) {
+	testStorageChangeTicks(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageRelations(t *testing.T) {
+	testStorageRelations(t, NewEntityArchetypeStorage())
+}
+
+func TestArchetypeStorageMoveComponents(t *testing.T) {
+	storage := NewEntityArchetypeStorage()
+	fillStorage(storage, 10)
+
+	otherType := otherComponentId
+	testType := testComponentId
+
+	storage.AddComponent(3, &otherComponent{x: 3})
+	storage.AddComponent(5, &otherComponent{x: 5})
+	assert.ElementsMatch(t, []EntityId{3, 5}, storage.FindAll(QueryFilter{With: []ComponentId{otherType}}))
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testType}}), 10)
+
+	// moving entities out of an archetype must keep the remaining rows intact
+	storage.RemoveComponent(3, testType)
+	storage.Delete(0)
+	assert.Nil(t, storage.GetComponent(3, testType))
+	assert.Equal(t, 3, storage.GetComponent(3, otherType).(*otherComponent).x)
+	for _, id := range storage.FindAll(QueryFilter{With: []ComponentId{testType}}) {
+		component := storage.GetComponent(id, testType).(*testComponent)
+		assert.Equal(t, int32(id), component.a, "component should belong to entity %v", id)
+	}
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testType}}), 8)
+	assert.Len(t, storage.FindAll(QueryFilter{}), 9)
+
+	// replacing an existing component should not move the entity
+	storage.AddComponent(5, &otherComponent{x: 55})
+	assert.Equal(t, 55, storage.GetComponent(5, otherType).(*otherComponent).x)
+	assert.Len(t, storage.Get(5), 2)
+}
+
+func TestArchetypeStorageColumns(t *testing.T) {
+	storage := NewEntityArchetypeStorage()
+	testType := testComponentId
+
+	added := &testComponent{a: 1}
+	storage.Add(0, added)
+	first := storage.GetComponent(0, testType).(*testComponent)
+	assert.NotSame(t, added, first, "components should be copied into their column")
+	assert.Equal(t, added, first)
+
+	// fill more than a single page of the column
+	count := columnPageBytes / int(unsafe.Sizeof(testComponent{})) * 3
+	for n := 1; n < count; n++ {
+		storage.Add(EntityId(n), &testComponent{a: int32(n)})
+	}
+	second := storage.GetComponent(1, testType).(*testComponent)
+	assert.Equal(t, uintptr(unsafe.Pointer(first))+unsafe.Sizeof(testComponent{}), uintptr(unsafe.Pointer(second)), "rows should be contiguous")
+	assert.Same(t, first, storage.GetComponent(0, testType), "growing a column should not move its rows")
+
+	first.b = 5
+	assert.Equal(t, int32(5), storage.GetComponent(0, testType).(*testComponent).b, "writes through pointers should be stored")
+
+	// removing a row moves the last row into its place
+	storage.Delete(0)
+	assert.Nil(t, storage.GetComponent(0, testType))
+	assert.Equal(t, int32(count-1), storage.GetComponent(EntityId(count-1), testType).(*testComponent).a)
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testType}}), count-1)
+}
+
+func TestArchetypeStorageRemovedComponents(t *testing.T) {
+	sim := NewSimulation(NewEntityArchetypeStorage(), NewSequentialSystemExecutor())
+	first := sim.AddEntity(&testComponent{a: 1})
+	second := sim.AddEntity(&testComponent{a: 2})
+
+	// removed components must be copied before their row is reused
+	reader := &RemovedComponents[testComponent]{}
+	sim.DeleteEntity(first)
+	sim.RemoveComponent(second, testComponent{})
+	assert.Equal(t, []Removed[testComponent]{
+		{Id: first, Component: &testComponent{a: 1}},
+		{Id: second, Component: &testComponent{a: 2}},
+	}, reader.Read(sim))
+}
+
+func BenchmarkArchetypeStorageQuery(b *testing.B) {
+	benchmarkStorageQuery(b, NewEntityArchetypeStorage())
+}
+
+func BenchmarkArchetypeStorageCachedQuery(b *testing.B) {
+	benchmarkStorageCachedQuery(b, NewEntityArchetypeStorage())
+}
+
+func BenchmarkArchetypeStorageAddRemoveComponent(b *testing.B) {
+	benchmarkStorageAddRemoveComponent(b, NewEntityArchetypeStorage())
+}
@@ -1,60 +1,171 @@
 package ecs
 
 import (
-	"log"
-	"reflect"
+	"fmt"
+	"iter"
 )
 
-type componentMap = map[reflect.Type]interface{}
+type componentMap = map[ComponentId]interface{}
+
+// componentTicksMap holds pointers so that marking a component as changed never writes to
+// the map itself, keeping it safe while other components are read concurrently.
+type componentTicksMap = map[ComponentId]*ComponentTicks
 
 /// EntitySimpleStorage stores entities within a id-keyed map.
 type EntitySimpleStorage struct {
-	id   EntityId
-	data map[EntityId]componentMap
+	changeTicker
+	relationIndex
+	entityCacheIndex
+
+	id    EntityId
+	data  map[EntityId]componentMap
+	ticks map[EntityId]componentTicksMap
 }
 
 func NewEntitySimpleStorage() *EntitySimpleStorage {
 	return &EntitySimpleStorage{
-		data: map[EntityId]componentMap{},
+		relationIndex: newRelationIndex(),
+		data:          map[EntityId]componentMap{},
+		ticks:         map[EntityId]componentTicksMap{},
 	}
 }
 
-func (e *EntitySimpleStorage) Add(id EntityId, components ...interface{}) {
+func (e *EntitySimpleStorage) Add(id EntityId, components ...interface{}) error {
 	if _, exists := e.data[id]; exists {
-		log.Panicf("duplicate entity was added to EntitySimpleStorage: %v", id)
+		return fmt.Errorf("%w: %v", ErrDuplicateEntity, id)
 	}
-	e.data[id] = make(componentMap)
+
+	data := make(componentMap, len(components))
+	ticks := make(componentTicksMap, len(components))
+	tick := e.ChangeTick()
 	for _, component := range components {
-		e.data[id][reflect.TypeOf(component)] = component
+		pointer, info, err := resolveComponent(component)
+		if err != nil {
+			return err
+		}
+
+		componentTicks := newComponentTicks(tick)
+		data[info.Id] = pointer
+		ticks[info.Id] = &componentTicks
+	}
+
+	e.data[id] = data
+	e.ticks[id] = ticks
+	e.updateCaches(id, e.has(id))
+	return nil
+}
+
+// has returns a function reporting whether the entity has a component.
+func (e *EntitySimpleStorage) has(id EntityId) func(ComponentId) bool {
+	components := e.data[id]
+	return func(componentType ComponentId) bool {
+		_, exists := components[componentType]
+		return exists
 	}
 }
 
 func (e *EntitySimpleStorage) Delete(id EntityId) {
+	if _, exists := e.data[id]; exists {
+		e.uncache(id)
+	}
 	delete(e.data, id)
+	delete(e.ticks, id)
+	e.deleteRelations(id)
 }
 
-func (e *EntitySimpleStorage) FindAll(componentTypes []reflect.Type) []EntityId {
-	result := []EntityId{}
+func (e *EntitySimpleStorage) TryDelete(id EntityId) error {
+	if _, exists := e.data[id]; !exists {
+		return fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+	e.Delete(id)
+	return nil
+}
+
+func (e *EntitySimpleStorage) FindAll(filter QueryFilter) []EntityId {
+	return e.AppendAll([]EntityId{}, filter)
+}
+
+func (e *EntitySimpleStorage) AppendAll(result []EntityId, filter QueryFilter) []EntityId {
 	for entityId, components := range e.data {
-		matches := true
-		for _, componentType := range componentTypes {
-			if _, exists := components[componentType]; !exists {
-				matches = false
-				continue
-			}
+		matches := filter.Matches(func(componentType ComponentId) bool {
+			_, exists := components[componentType]
+			return exists
+		})
+		if matches && e.matchesChanges(filter, entityId) {
+			result = append(result, entityId)
 		}
+	}
+	return result
+}
+
+// matchesChanges returns whether the entity matches the change ticks and relations of the
+// filter.
+func (e *EntitySimpleStorage) matchesChanges(filter QueryFilter, id EntityId) bool {
+	if filter.tracksChanges() {
+		ticks := e.ticks[id]
+		matches := filter.MatchesTicks(func(componentType ComponentId) (ComponentTicks, bool) {
+			componentTicks, exists := ticks[componentType]
+			if !exists {
+				return ComponentTicks{}, false
+			}
+			return *componentTicks, true
+		})
 		if !matches {
-			continue
+			return false
 		}
-		result = append(result, entityId)
 	}
-	return result
+	return !filter.tracksRelations() || e.matchesRelations(filter, id)
 }
 
-func (e *EntitySimpleStorage) GetComponent(id EntityId, componentType reflect.Type) interface{} {
+func (e *EntitySimpleStorage) ReleaseQuery(cache QueryCache) {
+	e.releaseQuery(cache)
+}
+
+func (e *EntitySimpleStorage) CacheQuery(filter QueryFilter) QueryCache {
+	return e.cacheQuery(filter, e.FindAll, func(filter QueryFilter) func(EntityId) bool {
+		return func(id EntityId) bool {
+			return e.matchesChanges(filter, id)
+		}
+	})
+}
+
+func (e *EntitySimpleStorage) GetComponent(id EntityId, componentType ComponentId) interface{} {
 	return e.data[id][componentType]
 }
 
+func (e *EntitySimpleStorage) TryGetComponent(id EntityId, componentType ComponentId) (interface{}, error) {
+	components, exists := e.data[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	component, exists := components[componentType]
+	if !exists {
+		return nil, fmt.Errorf("%w: entity %v has no component %v", ErrComponentNotFound, id, componentType)
+	}
+	return component, nil
+}
+
+func (e *EntitySimpleStorage) Entities() iter.Seq[EntityId] {
+	return func(yield func(EntityId) bool) {
+		for id := range e.data {
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+func (e *EntitySimpleStorage) Components(id EntityId) iter.Seq2[ComponentId, interface{}] {
+	return func(yield func(ComponentId, interface{}) bool) {
+		for componentType, component := range e.data[id] {
+			if !yield(componentType, component) {
+				return
+			}
+		}
+	}
+}
+
 func (e *EntitySimpleStorage) Get(id EntityId) []interface{} {
 	components := e.data[id]
 	result := make([]interface{}, len(components))
@@ -70,10 +181,60 @@ func (e *EntitySimpleStorage) GetComponentMap(id EntityId) componentMap {
 	return e.data[id]
 }
 
-func (e *EntitySimpleStorage) RemoveComponent(id EntityId, componentType reflect.Type) {
+func (e *EntitySimpleStorage) RemoveComponent(id EntityId, componentType ComponentId) {
+	if _, exists := e.data[id][componentType]; !exists {
+		return
+	}
+
 	delete(e.data[id], componentType)
+	delete(e.ticks[id], componentType)
+	e.updateCaches(id, e.has(id))
 }
 
-func (e *EntitySimpleStorage) AddComponent(id EntityId, component interface{}) {
-	e.data[id][reflect.TypeOf(component)] = component
+func (e *EntitySimpleStorage) TryRemoveComponent(id EntityId, componentType ComponentId) error {
+	if _, err := e.TryGetComponent(id, componentType); err != nil {
+		return err
+	}
+	e.RemoveComponent(id, componentType)
+	return nil
+}
+
+func (e *EntitySimpleStorage) AddComponent(id EntityId, component interface{}) error {
+	component, info, err := resolveComponent(component)
+	if err != nil {
+		return err
+	}
+	_, err = e.SetComponent(id, info.Id, component)
+	return err
+}
+
+func (e *EntitySimpleStorage) SetComponent(id EntityId, componentType ComponentId, component interface{}) (bool, error) {
+	components, exists := e.data[id]
+	if !exists {
+		return false, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+	components[componentType] = component
+
+	if ticks, exists := e.ticks[id][componentType]; exists {
+		ticks.Changed = e.ChangeTick()
+		return false, nil
+	}
+	ticks := newComponentTicks(e.ChangeTick())
+	e.ticks[id][componentType] = &ticks
+	e.updateCaches(id, e.has(id))
+	return true, nil
+}
+
+func (e *EntitySimpleStorage) MarkChanged(id EntityId, componentType ComponentId) {
+	if ticks, exists := e.ticks[id][componentType]; exists {
+		ticks.Changed = e.ChangeTick()
+	}
+}
+
+func (e *EntitySimpleStorage) ComponentTicks(id EntityId, componentType ComponentId) (ComponentTicks, bool) {
+	ticks, exists := e.ticks[id][componentType]
+	if !exists {
+		return ComponentTicks{}, false
+	}
+	return *ticks, true
 }
@@ -13,3 +13,51 @@ func TestSimpleStorageEmptyQuery(t *testing.T) {
 func TestSimpleStorageSimpleQuery(t *testing.T) {
 	testStorageSimpleQuery(t, NewEntitySimpleStorage())
 }
+
+func TestSimpleStorageAddRemoveComponent(t *testing.T) {
+	testStorageAddRemoveComponent(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageValueComponents(t *testing.T) {
+	testStorageValueComponents(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageErrors(t *testing.T) {
+	testStorageErrors(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageParForEach(t *testing.T) {
+	testStorageParForEach(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageCachedQuery(t *testing.T) {
+	testStorageCachedQuery(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageIterators(t *testing.T) {
+	testStorageIterators(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageFilters(t *testing.T) {
+	testStorageFilters(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageChangeTicks(t *testing.T) {
+	testStorageChangeTicks(t, NewEntitySimpleStorage())
+}
+
+func TestSimpleStorageRelations(t *testing.T) {
+	testStorageRelations(t, NewEntitySimpleStorage())
+}
+
+func BenchmarkSimpleStorageQuery(b *testing.B) {
+	benchmarkStorageQuery(b, NewEntitySimpleStorage())
+}
+
+func BenchmarkSimpleStorageCachedQuery(b *testing.B) {
+	benchmarkStorageCachedQuery(b, NewEntitySimpleStorage())
+}
+
+func BenchmarkSimpleStorageAddRemoveComponent(b *testing.B) {
+	benchmarkStorageAddRemoveComponent(b, NewEntitySimpleStorage())
+}
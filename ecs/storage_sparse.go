@@ -0,0 +1,491 @@
+package ecs
+
+import (
+	"fmt"
+	"iter"
+)
+
+const (
+	sparsePageBits = 12
+	sparsePageSize = 1 << sparsePageBits
+	sparsePageMask = sparsePageSize - 1
+)
+
+// sparseSet maps entity ids to a densely packed array of values. The sparse index is
+// keyed by the index of the entity id and paged so that large indexes only allocate the
+// pages they touch.
+type sparseSet struct {
+	// pages of dense indexes offset by one, so that zero marks an absent entity
+	pages  [][]uint32
+	dense  []EntityId
+	values []interface{}
+	ticks  []ComponentTicks
+}
+
+func newSparseSet() *sparseSet {
+	return &sparseSet{
+		pages:  [][]uint32{},
+		dense:  []EntityId{},
+		values: []interface{}{},
+		ticks:  []ComponentTicks{},
+	}
+}
+
+// slot returns the dense index held by the index of the given entity, which may belong to a
+// different generation of the entity, or -1 if the index is not in the set.
+func (s *sparseSet) slot(id EntityId) int {
+	page := int(id.Index() >> sparsePageBits)
+	if page >= len(s.pages) || s.pages[page] == nil {
+		return -1
+	}
+	return int(s.pages[page][id.Index()&sparsePageMask]) - 1
+}
+
+// index returns the dense index for the given entity, or -1 if it is not in the set.
+func (s *sparseSet) index(id EntityId) int {
+	index := s.slot(id)
+	// the slot may be held by a different generation of the entity
+	if index == -1 || s.dense[index] != id {
+		return -1
+	}
+	return index
+}
+
+// occupant returns the entity holding the index of the given entity, which may be a
+// different generation of it.
+func (s *sparseSet) occupant(id EntityId) (EntityId, bool) {
+	index := s.slot(id)
+	if index == -1 {
+		return 0, false
+	}
+	return s.dense[index], true
+}
+
+func (s *sparseSet) setIndex(id EntityId, index int) {
+	page := int(id.Index() >> sparsePageBits)
+	for page >= len(s.pages) {
+		s.pages = append(s.pages, nil)
+	}
+	if s.pages[page] == nil {
+		s.pages[page] = make([]uint32, sparsePageSize)
+	}
+	s.pages[page][id.Index()&sparsePageMask] = uint32(index + 1)
+}
+
+func (s *sparseSet) contains(id EntityId) bool {
+	return s.index(id) != -1
+}
+
+func (s *sparseSet) get(id EntityId) interface{} {
+	index := s.index(id)
+	if index == -1 {
+		return nil
+	}
+	return s.values[index]
+}
+
+// insert adds the entity to the set, replacing its value (and marking it as changed) if it
+// is already present.
+func (s *sparseSet) insert(id EntityId, value interface{}, tick uint64) {
+	if index := s.index(id); index != -1 {
+		s.values[index] = value
+		s.ticks[index].Changed = tick
+		return
+	}
+
+	s.setIndex(id, len(s.dense))
+	s.dense = append(s.dense, id)
+	s.values = append(s.values, value)
+	s.ticks = append(s.ticks, newComponentTicks(tick))
+}
+
+// remove takes the entity out of the set by moving the last dense entry into its place,
+// returning false if the entity was not in the set.
+func (s *sparseSet) remove(id EntityId) bool {
+	index := s.index(id)
+	if index == -1 {
+		return false
+	}
+
+	last := len(s.dense) - 1
+	if index != last {
+		s.dense[index] = s.dense[last]
+		s.values[index] = s.values[last]
+		s.ticks[index] = s.ticks[last]
+		s.setIndex(s.dense[index], index)
+	}
+
+	s.dense = s.dense[:last]
+	s.values[last] = nil
+	s.values = s.values[:last]
+	s.ticks = s.ticks[:last]
+	s.pages[id.Index()>>sparsePageBits][id.Index()&sparsePageMask] = 0
+	return true
+}
+
+func (s *sparseSet) len() int {
+	return len(s.dense)
+}
+
+/// EntitySparseSetStorage stores each component type within its own sparse set. Adding
+///  and removing components is O(1) and never moves other components, making it well
+///  suited for tag-like components which are frequently toggled.
+type EntitySparseSetStorage struct {
+	changeTicker
+	relationIndex
+	entityCacheIndex
+
+	entities *sparseSet
+	// sets is indexed by component id, holding nil for components no entity has had
+	sets  []*sparseSet
+	types []ComponentId
+}
+
+func NewEntitySparseSetStorage() *EntitySparseSetStorage {
+	return &EntitySparseSetStorage{
+		relationIndex: newRelationIndex(),
+		entities:      newSparseSet(),
+		sets:          []*sparseSet{},
+		types:         []ComponentId{},
+	}
+}
+
+// existing returns the set of the given component type, or nil if no entity has had it.
+func (e *EntitySparseSetStorage) existing(componentType ComponentId) *sparseSet {
+	if int(componentType) >= len(e.sets) {
+		return nil
+	}
+	return e.sets[componentType]
+}
+
+func (e *EntitySparseSetStorage) set(componentType ComponentId) *sparseSet {
+	for int(componentType) >= len(e.sets) {
+		e.sets = append(e.sets, nil)
+	}
+
+	set := e.sets[componentType]
+	if set == nil {
+		set = newSparseSet()
+		e.sets[componentType] = set
+		e.types = append(e.types, componentType)
+	}
+	return set
+}
+
+func (e *EntitySparseSetStorage) Add(id EntityId, components ...interface{}) error {
+	// sets are keyed by entity index, so only one generation of an entity may be stored
+	if existing, held := e.entities.occupant(id); held {
+		if existing.Generation() > id.Generation() {
+			return fmt.Errorf("%w: %v has been replaced by %v", ErrStaleEntity, id, existing)
+		}
+		return fmt.Errorf("%w: %v shares its index with %v", ErrDuplicateEntity, id, existing)
+	}
+
+	resolved := make([]interface{}, len(components))
+	componentTypes := make([]ComponentId, len(components))
+	for index, component := range components {
+		pointer, info, err := resolveComponent(component)
+		if err != nil {
+			return err
+		}
+		resolved[index] = pointer
+		componentTypes[index] = info.Id
+	}
+
+	tick := e.ChangeTick()
+	e.entities.insert(id, nil, tick)
+	for index, component := range resolved {
+		e.set(componentTypes[index]).insert(id, component, tick)
+	}
+	e.updateCaches(id, e.has(id))
+	return nil
+}
+
+// has returns a function reporting whether the entity has a component.
+func (e *EntitySparseSetStorage) has(id EntityId) func(ComponentId) bool {
+	return func(componentType ComponentId) bool {
+		set := e.existing(componentType)
+		return set != nil && set.contains(id)
+	}
+}
+
+func (e *EntitySparseSetStorage) Delete(id EntityId) {
+	if !e.entities.remove(id) {
+		return
+	}
+	e.uncache(id)
+
+	for _, componentType := range e.types {
+		e.sets[componentType].remove(id)
+	}
+	e.deleteRelations(id)
+}
+
+func (e *EntitySparseSetStorage) TryDelete(id EntityId) error {
+	if !e.entities.contains(id) {
+		return fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+	e.Delete(id)
+	return nil
+}
+
+// sparseFilter is a QueryFilter with each component type resolved to its sparse set, nil
+// where no entity has ever had the component.
+type sparseFilter struct {
+	with    []*sparseSet
+	without []*sparseSet
+	anyOf   [][]*sparseSet
+	added   []*sparseSet
+	changed []*sparseSet
+	since   uint64
+}
+
+// resolveFilter looks up the set of each component of the filter. The sets are stored within
+// the given buffer while it has room, so that callers can keep small filters off the heap.
+func (e *EntitySparseSetStorage) resolveFilter(filter QueryFilter, buffer []*sparseSet) sparseFilter {
+	lookup := func(sets []*sparseSet, componentTypes []ComponentId) []*sparseSet {
+		for index, componentType := range componentTypes {
+			sets[index] = e.existing(componentType)
+		}
+		return sets
+	}
+	resolve := func(componentTypes []ComponentId) []*sparseSet {
+		if len(componentTypes) == 0 {
+			return nil
+		}
+		if len(componentTypes) > len(buffer) {
+			return lookup(make([]*sparseSet, len(componentTypes)), componentTypes)
+		}
+
+		sets := buffer[:len(componentTypes):len(componentTypes)]
+		buffer = buffer[len(componentTypes):]
+		return lookup(sets, componentTypes)
+	}
+
+	result := sparseFilter{
+		with:    resolve(filter.With),
+		without: resolve(filter.Without),
+		added:   resolve(filter.Added),
+		changed: resolve(filter.Changed),
+		since:   filter.Since,
+	}
+	if len(filter.AnyOf) > 0 {
+		result.anyOf = make([][]*sparseSet, len(filter.AnyOf))
+		for index, group := range filter.AnyOf {
+			// groups are stored on the heap, so they can not use the buffer
+			result.anyOf[index] = lookup(make([]*sparseSet, len(group)), group)
+		}
+	}
+	return result
+}
+
+func (f *sparseFilter) matches(id EntityId) bool {
+	for _, set := range f.with {
+		if !set.contains(id) {
+			return false
+		}
+	}
+
+	for _, set := range f.without {
+		if set != nil && set.contains(id) {
+			return false
+		}
+	}
+
+	for _, group := range f.anyOf {
+		matched := false
+		for _, set := range group {
+			if set != nil && set.contains(id) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, set := range f.added {
+		index := -1
+		if set != nil {
+			index = set.index(id)
+		}
+		if index == -1 || set.ticks[index].Added <= f.since {
+			return false
+		}
+	}
+
+	for _, set := range f.changed {
+		index := -1
+		if set != nil {
+			index = set.index(id)
+		}
+		if index == -1 || set.ticks[index].Changed <= f.since {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *EntitySparseSetStorage) FindAll(filter QueryFilter) []EntityId {
+	return e.AppendAll([]EntityId{}, filter)
+}
+
+func (e *EntitySparseSetStorage) AppendAll(result []EntityId, filter QueryFilter) []EntityId {
+	var buffer [8]*sparseSet
+	resolved := e.resolveFilter(filter, buffer[:])
+
+	// iterate the smallest required set (or every entity if no components are required),
+	// checking the rest of the filter against each candidate
+	candidates := e.entities
+	for _, set := range resolved.with {
+		if set == nil || set.len() == 0 {
+			return result
+		}
+		if candidates == e.entities || set.len() < candidates.len() {
+			candidates = set
+		}
+	}
+
+	for _, id := range candidates.dense {
+		if resolved.matches(id) && (!filter.tracksRelations() || e.matchesRelations(filter, id)) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (e *EntitySparseSetStorage) ReleaseQuery(cache QueryCache) {
+	e.releaseQuery(cache)
+}
+
+func (e *EntitySparseSetStorage) CacheQuery(filter QueryFilter) QueryCache {
+	return e.cacheQuery(filter, e.FindAll, func(filter QueryFilter) func(EntityId) bool {
+		// cached entities already match the components, so only the ticks are resolved
+		resolved := e.resolveFilter(QueryFilter{Added: filter.Added, Changed: filter.Changed, Since: filter.Since}, nil)
+		return func(id EntityId) bool {
+			return resolved.matches(id) && (!filter.tracksRelations() || e.matchesRelations(filter, id))
+		}
+	})
+}
+
+func (e *EntitySparseSetStorage) GetComponent(id EntityId, componentType ComponentId) interface{} {
+	set := e.existing(componentType)
+	if set == nil {
+		return nil
+	}
+	return set.get(id)
+}
+
+func (e *EntitySparseSetStorage) TryGetComponent(id EntityId, componentType ComponentId) (interface{}, error) {
+	if !e.entities.contains(id) {
+		return nil, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	component := e.GetComponent(id, componentType)
+	if component == nil {
+		return nil, fmt.Errorf("%w: entity %v has no component %v", ErrComponentNotFound, id, componentType)
+	}
+	return component, nil
+}
+
+func (e *EntitySparseSetStorage) Entities() iter.Seq[EntityId] {
+	return func(yield func(EntityId) bool) {
+		for _, id := range e.entities.dense {
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+func (e *EntitySparseSetStorage) Components(id EntityId) iter.Seq2[ComponentId, interface{}] {
+	return func(yield func(ComponentId, interface{}) bool) {
+		if !e.entities.contains(id) {
+			return
+		}
+
+		for _, componentType := range e.types {
+			if component := e.sets[componentType].get(id); component != nil {
+				if !yield(componentType, component) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *EntitySparseSetStorage) Get(id EntityId) []interface{} {
+	result := []interface{}{}
+	if !e.entities.contains(id) {
+		return result
+	}
+
+	for _, componentType := range e.types {
+		if component := e.sets[componentType].get(id); component != nil {
+			result = append(result, component)
+		}
+	}
+	return result
+}
+
+func (e *EntitySparseSetStorage) RemoveComponent(id EntityId, componentType ComponentId) {
+	if set := e.existing(componentType); set != nil && set.remove(id) {
+		e.updateCaches(id, e.has(id))
+	}
+}
+
+func (e *EntitySparseSetStorage) TryRemoveComponent(id EntityId, componentType ComponentId) error {
+	if _, err := e.TryGetComponent(id, componentType); err != nil {
+		return err
+	}
+	e.RemoveComponent(id, componentType)
+	return nil
+}
+
+func (e *EntitySparseSetStorage) AddComponent(id EntityId, component interface{}) error {
+	component, info, err := resolveComponent(component)
+	if err != nil {
+		return err
+	}
+	_, err = e.SetComponent(id, info.Id, component)
+	return err
+}
+
+func (e *EntitySparseSetStorage) SetComponent(id EntityId, componentType ComponentId, component interface{}) (bool, error) {
+	if !e.entities.contains(id) {
+		return false, fmt.Errorf("%w: %v", ErrEntityNotFound, id)
+	}
+
+	set := e.set(componentType)
+	added := !set.contains(id)
+	set.insert(id, component, e.ChangeTick())
+	if added {
+		e.updateCaches(id, e.has(id))
+	}
+	return added, nil
+}
+
+func (e *EntitySparseSetStorage) MarkChanged(id EntityId, componentType ComponentId) {
+	set := e.existing(componentType)
+	if set == nil {
+		return
+	}
+
+	if index := set.index(id); index != -1 {
+		set.ticks[index].Changed = e.ChangeTick()
+	}
+}
+
+func (e *EntitySparseSetStorage) ComponentTicks(id EntityId, componentType ComponentId) (ComponentTicks, bool) {
+	set := e.existing(componentType)
+	if set == nil {
+		return ComponentTicks{}, false
+	}
+
+	index := set.index(id)
+	if index == -1 {
+		return ComponentTicks{}, false
+	}
+	return set.ticks[index], true
+}
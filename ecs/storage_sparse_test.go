@@ -0,0 +1,80 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseSetStorageAdd(t *testing.T) {
+	testStorageAdd(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageEmptyQuery(t *testing.T) {
+	testStorageEmptyQuery(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageSimpleQuery(t *testing.T) {
+	testStorageSimpleQuery(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageAddRemoveComponent(t *testing.T) {
+	testStorageAddRemoveComponent(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageValueComponents(t *testing.T) {
+	testStorageValueComponents(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageErrors(t *testing.T) {
+	testStorageErrors(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageGenerations(t *testing.T) {
+	storage := NewEntitySparseSetStorage()
+	assert.NoError(t, storage.Add(NewEntityId(3, 1), &testComponent{a: 1}))
+	assert.ErrorIs(t, storage.Add(NewEntityId(3, 2), &testComponent{a: 2}), ErrDuplicateEntity)
+	assert.ErrorIs(t, storage.Add(NewEntityId(3, 0), &testComponent{a: 0}), ErrStaleEntity)
+	assert.Equal(t, int32(1), storage.GetComponent(NewEntityId(3, 1), testComponentId).(*testComponent).a)
+
+	// once the entity is deleted its index may be reused by any generation
+	storage.Delete(NewEntityId(3, 1))
+	assert.NoError(t, storage.Add(NewEntityId(3, 2), &testComponent{a: 2}))
+	assert.Nil(t, storage.GetComponent(NewEntityId(3, 1), testComponentId))
+}
+
+func TestSparseSetStorageParForEach(t *testing.T) {
+	testStorageParForEach(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageCachedQuery(t *testing.T) {
+	testStorageCachedQuery(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageIterators(t *testing.T) {
+	testStorageIterators(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageFilters(t *testing.T) {
+	testStorageFilters(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageChangeTicks(t *testing.T) {
+	testStorageChangeTicks(t, NewEntitySparseSetStorage())
+}
+
+func TestSparseSetStorageRelations(t *testing.T) {
+	testStorageRelations(t, NewEntitySparseSetStorage())
+}
+
+func BenchmarkSparseSetStorageQuery(b *testing.B) {
+	benchmarkStorageQuery(b, NewEntitySparseSetStorage())
+}
+
+func BenchmarkSparseSetStorageCachedQuery(b *testing.B) {
+	benchmarkStorageCachedQuery(b, NewEntitySparseSetStorage())
+}
+
+func BenchmarkSparseSetStorageAddRemoveComponent(b *testing.B) {
+	benchmarkStorageAddRemoveComponent(b, NewEntitySparseSetStorage())
+}
@@ -1,6 +1,9 @@
 package ecs
 
 import (
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,6 +14,11 @@ type testComponent struct {
 	b int32
 }
 
+var (
+	testComponentId  = RegisterComponent[testComponent]("test.Test")
+	otherComponentId = RegisterComponent[otherComponent]("test.Other")
+)
+
 func fillStorage(storage EntityStorage, count int) {
 	for n := 0; n < count; n++ {
 		storage.Add(EntityId(n), &testComponent{a: int32(n), b: int32(n + 1)})
@@ -73,3 +81,456 @@ func testStorageSimpleQuery(t *testing.T, storage EntityStorage) {
 
 	assert.Equal(t, 10000, count, "simple query should return all matching entities")
 }
+
+func testStorageAddRemoveComponent(t *testing.T, storage EntityStorage) {
+	fillStorage(storage, 1000)
+	otherType := otherComponentId
+	testType := testComponentId
+
+	for n := 0; n < 1000; n += 2 {
+		storage.AddComponent(EntityId(n), &otherComponent{x: n})
+	}
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{otherType}}), 500, "added components should be queryable")
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testType, otherType}}), 500, "added components should be queryable")
+
+	// toggle the component a few times, as tag-like components would be
+	for n := 0; n < 3; n++ {
+		storage.RemoveComponent(2, otherType)
+		assert.Nil(t, storage.GetComponent(2, otherType), "removed component should not be returned")
+		storage.AddComponent(2, &otherComponent{x: n})
+		assert.Equal(t, n, storage.GetComponent(2, otherType).(*otherComponent).x)
+	}
+
+	for n := 0; n < 1000; n += 4 {
+		storage.RemoveComponent(EntityId(n), otherType)
+	}
+	storage.Delete(2)
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{otherType}}), 249, "removed components should not be queryable")
+	assert.Len(t, storage.FindAll(QueryFilter{}), 999, "entities without components should still exist")
+	assert.Empty(t, storage.Get(2), "deleted entity should have no components")
+
+	for _, id := range storage.FindAll(QueryFilter{With: []ComponentId{otherType, testType}}) {
+		assert.Equal(t, int(id), storage.GetComponent(id, otherType).(*otherComponent).x)
+		assert.Equal(t, int32(id), storage.GetComponent(id, testType).(*testComponent).a)
+	}
+}
+
+func testStorageValueComponents(t *testing.T, storage EntityStorage) {
+	assert.NoError(t, storage.Add(1, testComponent{a: 1}, otherComponent{x: 1}))
+	assert.NoError(t, storage.Add(2, &testComponent{a: 2}))
+	assert.NoError(t, storage.AddComponent(2, otherComponent{x: 2}))
+	assert.NoError(t, storage.AddComponent(2, testComponent{a: 3}))
+
+	// value components are stored as pointers so that queries find them
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testComponentId, otherComponentId}}), 2)
+	assert.Equal(t, int32(3), storage.GetComponent(2, testComponentId).(*testComponent).a)
+	assert.Equal(t, 2, storage.GetComponent(2, otherComponentId).(*otherComponent).x)
+
+	assert.ErrorIs(t, storage.AddComponent(3, &testComponent{}), ErrEntityNotFound)
+	assert.Len(t, storage.FindAll(QueryFilter{}), 2)
+}
+
+func testStorageErrors(t *testing.T, storage EntityStorage) {
+	assert.NoError(t, storage.Add(1, &testComponent{a: 1}))
+	assert.ErrorIs(t, storage.Add(1, &testComponent{a: 2}), ErrDuplicateEntity)
+	assert.Equal(t, int32(1), storage.GetComponent(1, testComponentId).(*testComponent).a, "duplicate entities should not be modified")
+	assert.ErrorIs(t, storage.Add(2, &unregisteredComponent{}), ErrInvalidComponentType)
+
+	// storages keyed by entity index reject other generations of an existing entity rather
+	// than overwriting its components
+	if err := storage.Add(NewEntityId(1, 1), &testComponent{a: 3}); err != nil {
+		assert.ErrorIs(t, err, ErrDuplicateEntity)
+	}
+	assert.NoError(t, storage.Add(NewEntityId(5, 2), &testComponent{a: 5}))
+	if err := storage.Add(NewEntityId(5, 1), &testComponent{a: 4}); err != nil {
+		assert.ErrorIs(t, err, ErrStaleEntity)
+	}
+	assert.Equal(t, int32(1), storage.GetComponent(1, testComponentId).(*testComponent).a)
+	assert.Equal(t, int32(5), storage.GetComponent(NewEntityId(5, 2), testComponentId).(*testComponent).a)
+	storage.Delete(NewEntityId(1, 1))
+	storage.Delete(NewEntityId(5, 1))
+	assert.ErrorIs(t, storage.AddComponent(1, 5), ErrInvalidComponentType)
+
+	component, err := storage.TryGetComponent(1, testComponentId)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), component.(*testComponent).a)
+	_, err = storage.TryGetComponent(1, otherComponentId)
+	assert.ErrorIs(t, err, ErrComponentNotFound)
+	_, err = storage.TryGetComponent(2, testComponentId)
+	assert.ErrorIs(t, err, ErrEntityNotFound)
+
+	assert.ErrorIs(t, storage.TryRemoveComponent(1, otherComponentId), ErrComponentNotFound)
+	assert.ErrorIs(t, storage.TryRemoveComponent(2, testComponentId), ErrEntityNotFound)
+	assert.NoError(t, storage.TryRemoveComponent(1, testComponentId))
+	assert.Nil(t, storage.GetComponent(1, testComponentId))
+
+	assert.NoError(t, storage.TryDelete(1))
+	assert.ErrorIs(t, storage.TryDelete(1), ErrEntityNotFound)
+}
+
+func testStorageParForEach(t *testing.T, storage EntityStorage) {
+	sim := NewSimulation(storage, NewSequentialSystemExecutor())
+	ids := make([]EntityId, 10000)
+	for n := range ids {
+		ids[n] = sim.AddEntity(&testComponent{a: int32(n)})
+		if n%2 == 0 {
+			sim.AddComponent(ids[n], &otherComponent{x: n})
+		}
+	}
+
+	query := NewQuery[struct {
+		Id    EntityId
+		Test  *testComponent  `ecs:"mut"`
+		Other *otherComponent `ecs:"read"`
+	}]()
+
+	var visited atomic.Int64
+	since := storage.AdvanceChangeTick()
+	query.ParForEachWith(sim, ParallelOptions{Workers: 8, MinBatchSize: 100}, func(item *struct {
+		Id    EntityId
+		Test  *testComponent  `ecs:"mut"`
+		Other *otherComponent `ecs:"read"`
+	}) {
+		item.Test.b = int32(item.Other.x) + 1
+		query.MarkChanged(sim, item.Id)
+		visited.Add(1)
+
+		// other entities can be read while the query is running
+		Get[testComponent](sim, ids[0])
+		sim.Frame.Commands.Despawn(item.Id)
+	})
+
+	assert.Equal(t, int64(5000), visited.Load(), "every matching entity should be visited once")
+	for n := 0; n < len(ids); n += 2 {
+		test, _ := Get[testComponent](sim, ids[n])
+		assert.Equal(t, int32(n+1), test.b)
+		ticks, _ := storage.ComponentTicks(ids[n], testComponentId)
+		assert.Equal(t, since, ticks.Changed, "modified components should be marked as changed")
+	}
+
+	assert.Equal(t, 5000, sim.Frame.Commands.Len(), "commands should be recorded from every worker")
+	sim.Frame.Commands.Flush()
+	assert.Len(t, storage.FindAll(QueryFilter{}), 5000)
+
+	// queries smaller than a single batch run on the calling goroutine
+	for n := 1; n < 20; n += 2 {
+		sim.AddComponent(ids[n], &otherComponent{x: n})
+	}
+	caller := goroutineId()
+	visited.Store(0)
+	query.ParForEach(sim, func(item *struct {
+		Id    EntityId
+		Test  *testComponent  `ecs:"mut"`
+		Other *otherComponent `ecs:"read"`
+	}) {
+		assert.Equal(t, caller, goroutineId())
+		visited.Add(1)
+	})
+	assert.Equal(t, int64(10), visited.Load())
+
+	// frames only visit entities changed since the system last ran
+	sim.Frame.LastRun = storage.AdvanceChangeTick()
+	storage.AdvanceChangeTick()
+	sim.MarkChanged(ids[1], otherComponent{})
+	changed := NewQuery[struct {
+		Id    EntityId
+		Other *otherComponent `ecs:"changed,read"`
+	}]()
+	frameVisited := []EntityId{}
+	changed.ParForEachFrame(sim.Frame, func(item *struct {
+		Id    EntityId
+		Other *otherComponent `ecs:"changed,read"`
+	}) {
+		frameVisited = append(frameVisited, item.Id)
+	})
+	assert.Equal(t, []EntityId{ids[1]}, frameVisited)
+}
+
+// goroutineId returns the id of the calling goroutine, parsed from its stack trace.
+func goroutineId() string {
+	buffer := make([]byte, 64)
+	buffer = buffer[:runtime.Stack(buffer, false)]
+	return strings.Fields(string(buffer))[1]
+}
+
+func testStorageCachedQuery(t *testing.T, storage EntityStorage) {
+	fillStorageMixed(storage, 100)
+	filter := QueryFilter{With: []ComponentId{testComponentId}, Without: []ComponentId{componentAId}}
+	cache := storage.CacheQuery(filter)
+	assert.ElementsMatch(t, storage.FindAll(filter), cache.FindAll(filter))
+	assert.Len(t, cache.FindAll(filter), 50)
+
+	// entities gaining and losing components are added and removed from the cache
+	storage.AddComponent(EntityId(0), &componentA{})
+	storage.AddComponent(EntityId(2), &testComponent{})
+	storage.RemoveComponent(EntityId(1), testComponentId)
+	storage.Delete(EntityId(4))
+	storage.Add(EntityId(100), &testComponent{}, &componentB{})
+	storage.Add(EntityId(101), &componentA{}, &testComponent{})
+
+	result := cache.FindAll(filter)
+	assert.ElementsMatch(t, storage.FindAll(filter), result)
+	assert.Len(t, result, 49)
+	assert.Contains(t, result, EntityId(2))
+	assert.Contains(t, result, EntityId(100), "new archetypes should be matched")
+	assert.NotContains(t, result, EntityId(0))
+	assert.NotContains(t, result, EntityId(1))
+	assert.NotContains(t, result, EntityId(4))
+	assert.NotContains(t, result, EntityId(101))
+
+	// changes and relations are checked whenever the cache is read
+	since := storage.ChangeTick()
+	storage.AdvanceChangeTick()
+	storage.MarkChanged(EntityId(8), testComponentId)
+	changed := filter
+	changed.Changed = []ComponentId{testComponentId}
+	changed.Since = since
+	assert.Equal(t, []EntityId{8}, cache.FindAll(changed))
+
+	likes := likesRelationId
+	storage.AddRelation(EntityId(5), likes, EntityId(9))
+	related := filter
+	related.Relations = []RelationFilter{{Relation: likes}}
+	assert.Equal(t, []EntityId{5}, cache.FindAll(related))
+
+	// cached queries return the same entities as uncached ones
+	sim := NewSimulation(storage, NewSequentialSystemExecutor())
+	query := NewQuery[struct {
+		Id   EntityId
+		Test *testComponent
+		A    *componentA `ecs:"without"`
+	}]()
+	cached := query.Cached()
+	assert.ElementsMatch(t, query.Execute(sim).ToList(), cached.Execute(sim).ToList())
+	storage.RemoveComponent(EntityId(5), testComponentId)
+	assert.ElementsMatch(t, query.Execute(sim).ToList(), cached.Execute(sim).ToList())
+	assert.Len(t, cached.Execute(sim).ToList(), 48)
+
+	// released caches are no longer updated
+	storage.ReleaseQuery(cache)
+	storage.Add(EntityId(102), &testComponent{}, &componentC{})
+	assert.NotContains(t, cache.FindAll(filter), EntityId(102))
+	cached.ReleaseCache(storage)
+	assert.Contains(t, cached.Execute(sim).ToList(), struct {
+		Id   EntityId
+		Test *testComponent
+		A    *componentA `ecs:"without"`
+	}{Id: 102, Test: storage.GetComponent(EntityId(102), testComponentId).(*testComponent)}, "released queries should cache again")
+}
+
+func testStorageIterators(t *testing.T, storage EntityStorage) {
+	fillStorageMixed(storage, 100)
+
+	entities := []EntityId{}
+	for id := range storage.Entities() {
+		entities = append(entities, id)
+	}
+	assert.ElementsMatch(t, storage.FindAll(QueryFilter{}), entities)
+
+	visited := 0
+	for range storage.Entities() {
+		visited++
+		if visited == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, visited, "iteration should stop early")
+
+	components := map[ComponentId]interface{}{}
+	for componentType, component := range storage.Components(EntityId(1)) {
+		components[componentType] = component
+	}
+	assert.Len(t, components, 2)
+	assert.Equal(t, int32(1), components[testComponentId].(*testComponent).a)
+	assert.Equal(t, 1, components[otherComponentId].(*otherComponent).x)
+
+	for range storage.Components(EntityId(1)) {
+		visited++
+		break
+	}
+	assert.Equal(t, 11, visited)
+
+	for range storage.Components(EntityId(3)) {
+		assert.Fail(t, "entities without components should not yield any")
+	}
+	for range storage.Components(EntityId(1000)) {
+		assert.Fail(t, "missing entities should not yield any components")
+	}
+}
+
+func testStorageFilters(t *testing.T, storage EntityStorage) {
+	fillStorageMixed(storage, 1000)
+	testType := testComponentId
+	otherType := otherComponentId
+	unusedType := componentCId
+
+	// mixed storage cycles through: test, test + other, other, and no components
+	assert.Len(t, storage.FindAll(QueryFilter{Without: []ComponentId{otherType}}), 500)
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{testType}, Without: []ComponentId{otherType}}), 250)
+	assert.Len(t, storage.FindAll(QueryFilter{Without: []ComponentId{unusedType}}), 1000)
+	assert.Len(t, storage.FindAll(QueryFilter{With: []ComponentId{unusedType}}), 0)
+
+	anyOf := storage.FindAll(QueryFilter{AnyOf: [][]ComponentId{{testType, otherType}}})
+	assert.Len(t, anyOf, 750)
+	for _, id := range anyOf {
+		assert.NotEqual(t, 3, int(id)%4, "entities without components should not match any of")
+	}
+
+	assert.Len(t, storage.FindAll(QueryFilter{AnyOf: [][]ComponentId{{testType}, {otherType}}}), 250)
+	assert.Len(t, storage.FindAll(QueryFilter{AnyOf: [][]ComponentId{{unusedType}}}), 0)
+	assert.Len(t, storage.FindAll(QueryFilter{
+		AnyOf:   [][]ComponentId{{testType, unusedType}},
+		Without: []ComponentId{otherType},
+	}), 250)
+}
+
+func testStorageChangeTicks(t *testing.T, storage EntityStorage) {
+	fillStorageMixed(storage, 100)
+	testType := testComponentId
+	otherType := otherComponentId
+
+	added := storage.ChangeTick()
+	ticks, exists := storage.ComponentTicks(EntityId(0), testType)
+	assert.True(t, exists)
+	assert.Equal(t, ComponentTicks{Added: added, Changed: added}, ticks)
+
+	tick := storage.AdvanceChangeTick()
+	assert.Greater(t, tick, added)
+	storage.MarkChanged(EntityId(0), testType)
+	storage.AddComponent(EntityId(0), &otherComponent{})
+
+	// moving the entity between archetypes must keep the ticks of its existing components
+	ticks, exists = storage.ComponentTicks(EntityId(0), testType)
+	assert.True(t, exists)
+	assert.Equal(t, ComponentTicks{Added: added, Changed: tick}, ticks)
+
+	assert.Equal(t, []EntityId{0}, storage.FindAll(QueryFilter{With: []ComponentId{testType}, Changed: []ComponentId{testType}, Since: added}))
+	assert.Equal(t, []EntityId{0}, storage.FindAll(QueryFilter{Added: []ComponentId{otherType}, Since: added}))
+	assert.Len(t, storage.FindAll(QueryFilter{Added: []ComponentId{testType}, Since: added}), 0)
+	assert.Len(t, storage.FindAll(QueryFilter{Changed: []ComponentId{testType}, Since: 0}), 50)
+
+	// replacing a component changes it without re-adding it
+	storage.AdvanceChangeTick()
+	storage.AddComponent(EntityId(1), &testComponent{})
+	assert.ElementsMatch(t, []EntityId{0, 1}, storage.FindAll(QueryFilter{Changed: []ComponentId{testType}, Since: added}))
+	assert.Len(t, storage.FindAll(QueryFilter{Added: []ComponentId{testType}, Since: added}), 0)
+
+	storage.RemoveComponent(EntityId(0), otherType)
+	_, exists = storage.ComponentTicks(EntityId(0), otherType)
+	assert.False(t, exists)
+	assert.Len(t, storage.FindAll(QueryFilter{Added: []ComponentId{otherType}, Since: added}), 0)
+}
+
+type likesRelation struct{}
+
+var likesRelationId = RegisterComponent[likesRelation]("test.Likes")
+
+type dockedAtRelation struct{}
+
+var dockedAtRelationId = RegisterComponent[dockedAtRelation]("test.DockedAt")
+
+func testStorageRelations(t *testing.T, storage EntityStorage) {
+	fillStorageMixed(storage, 100)
+	likes := likesRelationId
+	dockedAt := dockedAtRelationId
+	otherType := otherComponentId
+
+	storage.AddRelation(EntityId(1), likes, EntityId(2))
+	storage.AddRelation(EntityId(1), likes, EntityId(3))
+	storage.AddRelation(EntityId(1), likes, EntityId(2))
+	storage.AddRelation(EntityId(4), likes, EntityId(2))
+	storage.AddRelation(EntityId(4), dockedAt, EntityId(5))
+
+	assert.Equal(t, []EntityId{2, 3}, storage.RelationTargets(EntityId(1), likes), "duplicate pairs should be ignored")
+	assert.Equal(t, []EntityId{1, 4}, storage.RelationSources(likes, EntityId(2)))
+	assert.True(t, storage.HasRelation(EntityId(4), dockedAt, 0))
+	assert.False(t, storage.HasRelation(EntityId(4), dockedAt, EntityId(2)))
+
+	assert.ElementsMatch(t, []EntityId{1, 4}, storage.FindAll(QueryFilter{Relations: []RelationFilter{{Relation: likes}}}))
+	assert.Equal(t, []EntityId{4}, storage.FindAll(QueryFilter{Relations: []RelationFilter{{Relation: likes}, {Relation: dockedAt, Target: EntityId(5)}}}))
+	assert.Equal(t, []EntityId{1}, storage.FindAll(QueryFilter{With: []ComponentId{otherType}, Relations: []RelationFilter{{Relation: likes, Target: EntityId(2)}}}))
+	assert.Len(t, storage.FindAll(QueryFilter{WithoutRelations: []ComponentId{likes}}), 98)
+
+	storage.RemoveRelation(EntityId(1), likes, EntityId(3))
+	assert.Equal(t, []EntityId{2}, storage.RelationTargets(EntityId(1), likes))
+
+	// deleting the target removes every pair towards it
+	storage.Delete(EntityId(2))
+	assert.Len(t, storage.RelationTargets(EntityId(1), likes), 0)
+	assert.Len(t, storage.RelationSources(likes, EntityId(2)), 0)
+	assert.Equal(t, []EntityId{4}, storage.RelationSources(dockedAt, EntityId(5)))
+
+	// as does deleting the source
+	storage.Delete(EntityId(4))
+	assert.Len(t, storage.RelationSources(dockedAt, EntityId(5)), 0)
+	assert.Len(t, storage.FindAll(QueryFilter{Relations: []RelationFilter{{Relation: dockedAt}}}), 0)
+}
+
+func fillStorageMixed(storage EntityStorage, count int) {
+	for n := 0; n < count; n++ {
+		switch n % 4 {
+		case 0:
+			storage.Add(EntityId(n), &testComponent{a: int32(n), b: int32(n + 1)})
+		case 1:
+			storage.Add(EntityId(n), &testComponent{a: int32(n), b: int32(n + 1)}, &otherComponent{x: n})
+		case 2:
+			storage.Add(EntityId(n), &otherComponent{x: n})
+		default:
+			storage.Add(EntityId(n))
+		}
+	}
+}
+
+func benchmarkStorageQuery(b *testing.B, storage EntityStorage) {
+	fillStorageMixed(storage, 50000)
+
+	query := NewQuery[struct {
+		Id    EntityId
+		Test  *testComponent
+		Other *otherComponent
+	}]()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		iter := query.ExecuteStorage(storage)
+		for iter.Next() {
+		}
+	}
+}
+
+func benchmarkStorageCachedQuery(b *testing.B, storage EntityStorage) {
+	fillStorageMixed(storage, 50000)
+	for n := 0; n < 50000; n += 500 {
+		storage.AddComponent(EntityId(n), &componentA{})
+	}
+
+	query := NewQuery[struct {
+		Test *testComponent
+		A    *componentA
+	}]()
+	run := func(b *testing.B, query *Query[struct {
+		Test *testComponent
+		A    *componentA
+	}]) {
+		for n := 0; n < b.N; n++ {
+			iter := query.ExecuteStorage(storage)
+			for iter.Next() {
+			}
+		}
+	}
+
+	b.Run("Uncached", func(b *testing.B) { run(b, query) })
+	b.Run("Cached", func(b *testing.B) { run(b, query.Cached()) })
+}
+
+func benchmarkStorageAddRemoveComponent(b *testing.B, storage EntityStorage) {
+	fillStorageMixed(storage, 50000)
+	otherType := otherComponentId
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		id := EntityId(n % 50000)
+		storage.AddComponent(id, &otherComponent{x: n})
+		storage.RemoveComponent(id, otherType)
+	}
+}
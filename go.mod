@@ -1,17 +1,17 @@
 module github.com/b1naryth1ef/be
 
-go 1.19
+go 1.23
 
 require (
 	github.com/inkyblackness/imgui-go/v4 v4.6.0
 	github.com/nwillc/genfuncs v0.20.2
 	github.com/stretchr/testify v1.8.0
 	github.com/viant/xunsafe v0.8.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )